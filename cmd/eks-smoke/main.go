@@ -0,0 +1,309 @@
+// Command eks-smoke runs the EKS smoke test checklist against existing
+// clusters, e.g. after maintenance, without writing a Go test.
+//
+// Usage:
+//
+//	eks-smoke [flags] [kubeconfig...]
+//
+// Each kubeconfig is a file generated for an EKS cluster, e.g. by
+// `pulumi stack output kubeconfig`. If a Pulumi stack export is given with
+// -stack, the desired worker Node count of each cluster is read from its
+// NodeGroups; otherwise, Node readiness is not checked. If no kubeconfig is
+// given, the kubeconfig outputs of the stack are tested.
+//
+// eks-smoke exits with status 1 if any cluster fails the smoke test, and 2 on
+// invalid usage.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pulumi/pulumi-eks/utils"
+	"github.com/pulumi/pulumi/sdk/v2/go/common/apitype"
+)
+
+// stringsFlag is a flag that may be repeated, or given as a comma-separated
+// list.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string { return strings.Join(*f, ",") }
+
+func (f *stringsFlag) Set(value string) error {
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			*f = append(*f, s)
+		}
+	}
+	return nil
+}
+
+// durationsFlag is a repeatable flag of name=duration pairs.
+type durationsFlag map[string]time.Duration
+
+func (f durationsFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for name, d := range f {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", name, d))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (f durationsFlag) Set(value string) error {
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("expected name=duration, got %q", pair)
+		}
+		d, err := time.ParseDuration(parts[1])
+		if err != nil {
+			return err
+		}
+		f[strings.TrimSpace(parts[0])] = d
+	}
+	return nil
+}
+
+// namedFilesFlag is a repeatable flag of name=file pairs.
+type namedFilesFlag map[string]string
+
+func (f namedFilesFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for name, path := range f {
+		pairs = append(pairs, name+"="+path)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (f namedFilesFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("expected name=file, got %q", value)
+	}
+	f[parts[0]] = parts[1]
+	return nil
+}
+
+// kindSelectorsFlag is a repeatable flag of Kind=selector pairs.
+type kindSelectorsFlag map[string]string
+
+func (f kindSelectorsFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for kind, selector := range f {
+		pairs = append(pairs, kind+"="+selector)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (f kindSelectorsFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("expected Kind=selector, got %q", value)
+	}
+	f[parts[0]] = parts[1]
+	return nil
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	defaults := utils.DefaultSmokeTestOptions()
+	registry := utils.DefaultCheckRegistry()
+
+	var (
+		kubeconfigs    stringsFlag
+		checks         stringsFlag
+		namespaces     stringsFlag
+		excludes       stringsFlag
+		checkTimeouts  = make(durationsFlag)
+		namedConfigs   = make(namedFilesFlag)
+		fieldSelectors = make(kindSelectorsFlag)
+	)
+	flags := flag.NewFlagSet("eks-smoke", flag.ContinueOnError)
+	flags.Var(&kubeconfigs, "kubeconfig", "kubeconfig `file` of a cluster to test; may be repeated")
+	flags.Var(namedConfigs, "cluster",
+		"kubeconfig of a cluster as `name=file`, for clusters whose name cannot be resolved; may be repeated")
+	stack := flags.String("stack", "", "Pulumi stack export `file` to read the desired Node counts from")
+	timeout := flags.Duration("timeout", defaults.Timeout, "deadline of each check")
+	flags.Var(checkTimeouts, "check-timeout",
+		"deadline of a single check as `name=duration`, overriding -timeout; may be repeated")
+	pollInterval := flags.Duration("poll-interval", defaults.PollInterval, "initial interval in between polls")
+	maxPollInterval := flags.Duration("max-poll-interval", defaults.MaxPollInterval, "max interval in between polls")
+	parallelism := flags.Int("parallelism", 0, "number of clusters to test at once; 0 tests all at once")
+	flags.Var(&checks, "checks", fmt.Sprintf("comma-separated `names` of the checks to run, out of %s (default %s)",
+		strings.Join(registry.Names(), ","), strings.Join(registry.Enabled(), ",")))
+	flags.Var(&namespaces, "namespace", "limit readiness checks to the `namespaces`; may be repeated")
+	labelSelector := flags.String("selector", "", "limit readiness checks to objects matching the label `selector`")
+	flags.Var(fieldSelectors, "field-selector",
+		"limit readiness checks of a kind to objects matching a field selector, as `Kind=selector`, "+
+			"e.g. Pod=status.phase!=Succeeded; may be repeated")
+	flags.Var(&excludes, "exclude",
+		"ignore objects matching the `pattern` [Kind/]namespace/name, with wildcards; may be repeated")
+	terminalPods := flags.String("terminal-pods", string(utils.TerminalPodsReport),
+		"how to evaluate failed Pods that their controller has replaced with a ready Pod: report, ignore or fail")
+	asgRegion := flags.String("asg-region", "",
+		"attribute Nodes to self-managed node groups by the Auto Scaling group of their instance, "+
+			"looked up in `region` with the default AWS credentials; "+
+			"defaults to the aws:region of the -stack")
+	output := flags.String("output", "text", "output `format` of the report: text or json")
+	quiet := flags.Bool("quiet", false, "do not log progress to standard error")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	kubeconfigs = append(kubeconfigs, flags.Args()...)
+
+	usageErr := func(format string, args ...interface{}) int {
+		fmt.Fprintf(os.Stderr, "eks-smoke: "+format+"\n", args...)
+		flags.Usage()
+		return 2
+	}
+	if len(kubeconfigs) == 0 && len(namedConfigs) == 0 && *stack == "" {
+		return usageErr("at least one kubeconfig, or a -stack, is required")
+	}
+	if *output != "text" && *output != "json" {
+		return usageErr("unknown output format %q", *output)
+	}
+	terminalPodPolicy, err := utils.ParseTerminalPodPolicy(*terminalPods)
+	if err != nil {
+		return usageErr("%v", err)
+	}
+	if len(checks) > 0 {
+		if err := selectChecks(registry, checks); err != nil {
+			return usageErr("%v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+	}()
+
+	opts := utils.SmokeTestOptions{
+		Context:         ctx,
+		Timeout:         *timeout,
+		CheckTimeouts:   checkTimeouts,
+		PollInterval:    *pollInterval,
+		MaxPollInterval: *maxPollInterval,
+		Checks:          registry,
+		Parallelism:     *parallelism,
+		Filter: utils.ReadinessFilter{
+			Namespaces:     namespaces,
+			LabelSelector:  *labelSelector,
+			FieldSelectors: fieldSelectors,
+			Exclude:        excludes,
+			TerminalPods:   terminalPodPolicy,
+		},
+		Logger: utils.NewWriterLogger(os.Stderr),
+	}
+	if *quiet {
+		opts.Logger = utils.DiscardLogger
+	}
+	if *asgRegion != "" {
+		client, err := utils.NewAutoScalingClient(*asgRegion)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "eks-smoke: %v\n", err)
+			return 1
+		}
+		opts.AutoScaling = client
+	}
+
+	var resources []apitype.ResourceV3
+	var kubeconfigData []interface{}
+	if *stack != "" {
+		export, err := utils.LoadStackExport(*stack)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "eks-smoke: %v\n", err)
+			return 1
+		}
+		resources = export.Resources
+		if len(kubeconfigs) == 0 && len(namedConfigs) == 0 {
+			kubeconfigData = export.Kubeconfigs()
+			if len(kubeconfigData) == 0 {
+				fmt.Fprintf(os.Stderr, "eks-smoke: stack export %s has no kubeconfig outputs\n", *stack)
+				return 1
+			}
+		}
+	}
+
+	for _, path := range kubeconfigs {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "eks-smoke: %v\n", err)
+			return 1
+		}
+		kubeconfigData = append(kubeconfigData, data)
+	}
+	if len(namedConfigs) > 0 {
+		named := make(utils.NamedKubeconfigs)
+		for clusterName, path := range namedConfigs {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "eks-smoke: %v\n", err)
+				return 1
+			}
+			named[clusterName] = data
+		}
+		kubeconfigData = append(kubeconfigData, named)
+	}
+
+	report, err := utils.RunSmokeTest(opts, resources, kubeconfigData...)
+	if *output == "json" {
+		if werr := report.WriteJSON(os.Stdout); werr != nil {
+			fmt.Fprintf(os.Stderr, "eks-smoke: %v\n", werr)
+			return 1
+		}
+	} else {
+		if werr := report.WriteText(os.Stdout); werr != nil {
+			fmt.Fprintf(os.Stderr, "eks-smoke: %v\n", werr)
+			return 1
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "eks-smoke: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// selectChecks disables every registered check that is not named.
+func selectChecks(registry *utils.CheckRegistry, names []string) error {
+	selected := make(map[string]bool)
+	for _, name := range names {
+		selected[name] = true
+	}
+	for _, name := range registry.Names() {
+		if selected[name] {
+			registry.Enable(name)
+		} else {
+			registry.Disable(name)
+		}
+		delete(selected, name)
+	}
+	if len(selected) > 0 {
+		unknown := make([]string, 0, len(selected))
+		for name := range selected {
+			unknown = append(unknown, name)
+		}
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown checks %s; known checks are %s",
+			strings.Join(unknown, ", "), strings.Join(registry.Names(), ", "))
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ module github.com/pulumi/pulumi-eks
 go 1.15
 
 require (
+	github.com/aws/aws-sdk-go v1.29.27
 	github.com/docker/docker v1.13.1 // indirect
 	github.com/google/gofuzz v1.0.0 // indirect
 	github.com/googleapis/gnostic v0.2.0 // indirect
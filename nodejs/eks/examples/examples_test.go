@@ -34,6 +34,8 @@ func TestAccCluster(t *testing.T) {
 		With(integration.ProgramTestOptions{
 			Dir: path.Join(getCwd(t), "./cluster"),
 			ExtraRuntimeValidation: func(t *testing.T, info integration.RuntimeValidationStackInfo) {
+				utils.AssertKubeconfigLint(t, info.Outputs["kubeconfig1"], info.Deployment.Resources)
+				utils.AssertKubeconfigLint(t, info.Outputs["kubeconfig2"], info.Deployment.Resources)
 				utils.RunEKSSmokeTest(t,
 					info.Deployment.Resources,
 					info.Outputs["kubeconfig1"],
@@ -194,6 +196,21 @@ func TestAccScopedKubeconfig(t *testing.T) {
 					info.Deployment.Resources,
 					info.Outputs["kubeconfig"],
 				)
+
+				// The devs role may only work with Pods in the devs namespace.
+				namespace := info.Outputs["devsNamespace"].(string)
+				permissions := []utils.Permission{
+					{Verb: "list", Resource: "pods", Namespace: namespace, Allowed: true},
+					{Verb: "create", Resource: "pods", Namespace: namespace, Allowed: true},
+					{Verb: "delete", Resource: "pods", Namespace: namespace, Allowed: true},
+					{Verb: "list", Resource: "pods", Namespace: "kube-system", Allowed: false},
+					{Verb: "list", Resource: "secrets", Namespace: namespace, Allowed: false},
+					{Verb: "create", Group: "apps", Resource: "deployments", Namespace: namespace, Allowed: false},
+					{Verb: "list", Resource: "nodes", Allowed: false},
+				}
+				utils.AssertSubjectPermissions(t, info.Outputs["kubeconfig"],
+					utils.RBACSubject{User: "pulumi:alice", Groups: []string{"pulumi:devs"}}, permissions...)
+				utils.AssertSelfPermissions(t, info.Outputs["devsKubeconfig"], permissions...)
 			},
 		})
 
@@ -508,11 +525,7 @@ func TestAccMigrateNodeGroups(t *testing.T) {
 			Dir: path.Join(getCwd(t), "tests", "migrate-nodegroups"),
 			// Test NGINX on the 2xlarge node group.
 			ExtraRuntimeValidation: func(t *testing.T, stack integration.RuntimeValidationStackInfo) {
-				endpoint := fmt.Sprintf("%s/echoserver", stack.Outputs["nginxServiceUrl"].(string))
-				headers := map[string]string{"Host": "apps.example.com"}
-				utils.AssertHTTPResultWithRetry(t, endpoint, headers, 10*time.Minute, func(body string) bool {
-					return assert.NotEmpty(t, body, "Body should not be empty")
-				})
+				runMigrateNodeGroupsSmokeTest(t, stack)
 			},
 			EditDirs: []integration.EditDir{
 				// Add the new, 4xlarge node group.
@@ -520,11 +533,7 @@ func TestAccMigrateNodeGroups(t *testing.T) {
 					Dir:      path.Join(getCwd(t), "tests", "migrate-nodegroups", "steps", "step1"),
 					Additive: true,
 					ExtraRuntimeValidation: func(t *testing.T, stack integration.RuntimeValidationStackInfo) {
-						endpoint := fmt.Sprintf("%s/echoserver", stack.Outputs["nginxServiceUrl"].(string))
-						headers := map[string]string{"Host": "apps.example.com"}
-						utils.AssertHTTPResultWithRetry(t, endpoint, headers, 10*time.Minute, func(body string) bool {
-							return assert.NotEmpty(t, body, "Body should not be empty")
-						})
+						runMigrateNodeGroupsSmokeTest(t, stack)
 					},
 				},
 				// Migrate NGINX from the 2xlarge to the 4xlarge node group by
@@ -534,11 +543,7 @@ func TestAccMigrateNodeGroups(t *testing.T) {
 					Dir:      path.Join(getCwd(t), "tests", "migrate-nodegroups", "steps", "step2"),
 					Additive: true,
 					ExtraRuntimeValidation: func(t *testing.T, stack integration.RuntimeValidationStackInfo) {
-						endpoint := fmt.Sprintf("%s/echoserver", stack.Outputs["nginxServiceUrl"].(string))
-						headers := map[string]string{"Host": "apps.example.com"}
-						utils.AssertHTTPResultWithRetry(t, endpoint, headers, 10*time.Minute, func(body string) bool {
-							return assert.NotEmpty(t, body, "Body should not be empty")
-						})
+						runMigrateNodeGroupsSmokeTest(t, stack)
 
 						// Create kubeconfig clients from kubeconfig.
 						kubeconfig, err := json.Marshal(stack.Outputs["kubeconfig"])
@@ -551,8 +556,7 @@ func TestAccMigrateNodeGroups(t *testing.T) {
 						time.Sleep(5 * time.Minute)
 
 						// Assert all resources, across all namespaces are still ready after migration.
-						utils.AssertKindInAllNamespacesReady(t, kubeAccess.Clientset, "replicasets")
-						utils.AssertKindInAllNamespacesReady(t, kubeAccess.Clientset, "deployments")
+						utils.AssertKindsReady(t, kubeAccess.Clientset, "replicasets", "deployments")
 					},
 				},
 				// Remove the workload namespace, and the aws-cni DaemonSet.
@@ -623,6 +627,29 @@ func TestAccMigrateNodeGroups(t *testing.T) {
 	integration.ProgramTest(t, &test)
 }
 
+// runMigrateNodeGroupsSmokeTest runs the smoke test against the cluster of the
+// migrate-nodegroups stack, along with a check that NGINX serves the
+// echoserver, so that it is reported with the other checks. The rollout of the
+// aws-node and kube-proxy DaemonSets to the Nodes of each node group is
+// checked too, as it is what breaks during node group migrations.
+func runMigrateNodeGroupsSmokeTest(t *testing.T, stack integration.RuntimeValidationStackInfo) {
+	endpoint := fmt.Sprintf("%s/echoserver", stack.Outputs["nginxServiceUrl"].(string))
+	headers := map[string]string{"Host": "apps.example.com"}
+	checks := utils.DefaultCheckRegistry()
+	checks.Enable(utils.DaemonSetsCheckName)
+	err := checks.Register(utils.HTTPCheck("nginx-echoserver", endpoint, headers, 10*time.Minute,
+		func(body string) bool {
+			return body != ""
+		}))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	opts := utils.DefaultSmokeTestOptions()
+	opts.Checks = checks
+	utils.RunEKSSmokeTestWithOptions(t, opts, stack.Deployment.Resources, stack.Outputs["kubeconfig"])
+}
+
 func getEnvRegion(t *testing.T) string {
 	envRegion := os.Getenv("AWS_REGION")
 	if envRegion == "" {
@@ -86,3 +86,8 @@ const pod = new k8s.core.v1.Pod("nginx", {
         }],
     },
 }, { provider: roleProvider, dependsOn: devsGroupRoleBinding  });
+
+// Export the role-based kubeconfig and the devs namespace, to verify the
+// permissions of the devs role.
+export const devsKubeconfig = roleKubeconfig;
+export const devsNamespace = appsNamespace.metadata.name;
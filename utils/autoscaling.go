@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/autoscaling/autoscalingiface"
+)
+
+// maxDescribedInstances is the most instances that a single
+// DescribeAutoScalingInstances call describes.
+const maxDescribedInstances = 50
+
+// AutoScalingGroupResolver resolves the Auto Scaling groups of EC2 instances,
+// so that Nodes can be attributed to their self-managed node group.
+type AutoScalingGroupResolver interface {
+	// InstanceAutoScalingGroups maps the IDs of instances to the names of
+	// their Auto Scaling groups. Instances that are not in a group are
+	// omitted.
+	InstanceAutoScalingGroups(instanceIDs []string) (map[string]string, error)
+}
+
+// AutoScalingClient resolves the Auto Scaling groups of instances with the
+// EC2 Auto Scaling API.
+type AutoScalingClient struct {
+	API autoscalingiface.AutoScalingAPI
+}
+
+// NewAutoScalingClient returns a client of the Auto Scaling API of region,
+// with the credentials of the default credential chain of the AWS SDK,
+// including the shared config file.
+func NewAutoScalingClient(region string) (*AutoScalingClient, error) {
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            aws.Config{Region: aws.String(region)},
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating AWS session: %w", err)
+	}
+	return &AutoScalingClient{API: autoscaling.New(sess)}, nil
+}
+
+// InstanceAutoScalingGroups maps the IDs of instances to the names of their
+// Auto Scaling groups, with DescribeAutoScalingInstances.
+func (c *AutoScalingClient) InstanceAutoScalingGroups(instanceIDs []string) (map[string]string, error) {
+	groups := make(map[string]string)
+	for start := 0; start < len(instanceIDs); start += maxDescribedInstances {
+		end := start + maxDescribedInstances
+		if end > len(instanceIDs) {
+			end = len(instanceIDs)
+		}
+		out, err := c.API.DescribeAutoScalingInstances(&autoscaling.DescribeAutoScalingInstancesInput{
+			InstanceIds: aws.StringSlice(instanceIDs[start:end]),
+			MaxRecords:  aws.Int64(maxDescribedInstances),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("describing Auto Scaling instances: %w", err)
+		}
+		for _, instance := range out.AutoScalingInstances {
+			groups[aws.StringValue(instance.InstanceId)] = aws.StringValue(instance.AutoScalingGroupName)
+		}
+	}
+	return groups, nil
+}
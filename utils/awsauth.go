@@ -0,0 +1,449 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pulumi/pulumi/sdk/v2/go/common/apitype"
+	"github.com/pulumi/pulumi/sdk/v2/go/common/resource"
+	"gopkg.in/yaml.v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// nodeGroups are the Kubernetes groups that the IAM role of a worker Node
+// must be mapped to, for the Node to join the cluster.
+var nodeGroups = []string{"system:bootstrappers", "system:nodes"}
+
+// AWSAuthRoleMapping is an entry of the mapRoles of the aws-auth ConfigMap,
+// mapping an IAM role to a Kubernetes user and groups.
+type AWSAuthRoleMapping struct {
+	RoleARN  string   `yaml:"rolearn"`
+	Username string   `yaml:"username"`
+	Groups   []string `yaml:"groups"`
+}
+
+// AWSAuthUserMapping is an entry of the mapUsers of the aws-auth ConfigMap,
+// mapping an IAM user to a Kubernetes user and groups.
+type AWSAuthUserMapping struct {
+	UserARN  string   `yaml:"userarn"`
+	Username string   `yaml:"username"`
+	Groups   []string `yaml:"groups"`
+}
+
+// AWSAuth is the parsed content of the aws-auth ConfigMap, which maps IAM
+// identities to Kubernetes users and groups.
+type AWSAuth struct {
+	MapRoles []AWSAuthRoleMapping
+	MapUsers []AWSAuthUserMapping
+}
+
+// ParseAWSAuth parses the mapRoles and mapUsers of the aws-auth ConfigMap,
+// and validates that every entry has an ARN, a username and groups, and that
+// no ARN is mapped twice.
+func ParseAWSAuth(configMap *corev1.ConfigMap) (*AWSAuth, error) {
+	var awsAuth AWSAuth
+	if err := yaml.Unmarshal([]byte(configMap.Data["mapRoles"]), &awsAuth.MapRoles); err != nil {
+		return nil, fmt.Errorf("malformed mapRoles: %w", err)
+	}
+	if err := yaml.Unmarshal([]byte(configMap.Data["mapUsers"]), &awsAuth.MapUsers); err != nil {
+		return nil, fmt.Errorf("malformed mapUsers: %w", err)
+	}
+
+	var problems []string
+	roles := make(map[string]bool)
+	for i, m := range awsAuth.MapRoles {
+		problems = append(problems, mappingProblems(fmt.Sprintf("mapRoles[%d]", i), "rolearn",
+			m.RoleARN, m.Username, m.Groups, roles)...)
+	}
+	users := make(map[string]bool)
+	for i, m := range awsAuth.MapUsers {
+		problems = append(problems, mappingProblems(fmt.Sprintf("mapUsers[%d]", i), "userarn",
+			m.UserARN, m.Username, m.Groups, users)...)
+	}
+	if len(problems) > 0 {
+		return &awsAuth, fmt.Errorf("invalid aws-auth entries: %s", strings.Join(problems, "; "))
+	}
+	return &awsAuth, nil
+}
+
+// mappingProblems validates a single mapRoles or mapUsers entry, recording
+// its ARN in seen to detect duplicates.
+func mappingProblems(entry, arnKey, arn, username string, groups []string, seen map[string]bool) []string {
+	var problems []string
+	switch {
+	case arn == "":
+		problems = append(problems, fmt.Sprintf("%s has no %s", entry, arnKey))
+	case seen[arn]:
+		problems = append(problems, fmt.Sprintf("%s duplicates %s %s", entry, arnKey, arn))
+	}
+	seen[arn] = true
+	if arn != "" {
+		entry += fmt.Sprintf(" (%s)", arn)
+	}
+	if username == "" {
+		problems = append(problems, fmt.Sprintf("%s has no username", entry))
+	}
+	if len(groups) == 0 {
+		problems = append(problems, fmt.Sprintf("%s has no groups", entry))
+	}
+	return problems
+}
+
+// ValidateNodeRoles validates that each of the IAM roles of the worker Nodes
+// is mapped to the system:bootstrappers and system:nodes groups.
+func (a *AWSAuth) ValidateNodeRoles(roleARNs []string) error {
+	var problems []string
+	for _, arn := range roleARNs {
+		var mapping *AWSAuthRoleMapping
+		for i := range a.MapRoles {
+			if a.MapRoles[i].RoleARN == arn {
+				mapping = &a.MapRoles[i]
+				break
+			}
+		}
+		if mapping == nil {
+			problems = append(problems, fmt.Sprintf("node role %s is not mapped", arn))
+			continue
+		}
+		for _, group := range nodeGroups {
+			if !containsString(mapping.Groups, group) {
+				problems = append(problems, fmt.Sprintf("node role %s is not mapped to group %s", arn, group))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// validateAWSAuth parses and validates the aws-auth ConfigMap, and validates
+// that it maps each of the IAM roles of the worker Nodes.
+func validateAWSAuth(configMap *corev1.ConfigMap, nodeRoleARNs []string) (*AWSAuth, error) {
+	if len(configMap.Data) == 0 {
+		return nil, fmt.Errorf("ConfigMap should not be empty")
+	}
+	awsAuth, err := ParseAWSAuth(configMap)
+	if err != nil {
+		return nil, err
+	}
+	return awsAuth, awsAuth.ValidateNodeRoles(nodeRoleARNs)
+}
+
+func containsString(strs []string, s string) bool {
+	for _, str := range strs {
+		if str == s {
+			return true
+		}
+	}
+	return false
+}
+
+// clusterNodeRolesMap implements a map of Kubernetes cluster names to the
+// ARNs of the IAM roles of their worker Nodes.
+type clusterNodeRolesMap map[string][]string
+
+// mapClusterToNodeRoles iterates through all Pulumi stack resources looking
+// for the IAM roles of the worker Nodes of each cluster:
+//
+//   - the default instance role created by the Cluster component,
+//   - the role of the instance profile of the launch configuration of each
+//     CloudFormation-based NodeGroup,
+//   - the nodeRoleArn of each AWS managed node group.
+//
+// The inputs of the Cluster component, e.g. its instanceRoles, are not
+// recorded in the stack, so roles are only found through these resources.
+func mapClusterToNodeRoles(resources []apitype.ResourceV3) (clusterNodeRolesMap, error) {
+	roleARNs := make(map[string]string)             // role name -> ARN
+	profileRoles := make(map[string]string)         // instance profile name -> role name
+	launchConfigProfiles := make(map[string]string) // launch configuration name -> instance profile name
+	componentClusters := mapComponentToClusterName(resources)
+	parents := make(map[resource.URN]resource.URN)
+	for _, res := range resources {
+		parents[res.URN] = res.Parent
+		switch res.Type.String() {
+		case "aws:iam/role:Role":
+			roleARNs[stringOutput(res, "name")] = stringOutput(res, "arn")
+		case "aws:iam/instanceProfile:InstanceProfile":
+			profileRoles[stringOutput(res, "name")] = stringOutput(res, "role")
+		case "aws:ec2/launchConfiguration:LaunchConfiguration":
+			launchConfigProfiles[stringOutput(res, "name")] = stringOutput(res, "iamInstanceProfile")
+		}
+	}
+
+	clusterToNodeRoles := make(clusterNodeRolesMap)
+	add := func(clusterName, arn string) {
+		if clusterName != "" && arn != "" && !containsString(clusterToNodeRoles[clusterName], arn) {
+			clusterToNodeRoles[clusterName] = append(clusterToNodeRoles[clusterName], arn)
+		}
+	}
+
+	for _, res := range resources {
+		switch {
+		case strings.HasPrefix(res.ID.String(), "arn:aws:cloudformation"):
+			var templateBody cloudFormationTemplateBody
+			body, _ := res.Outputs["templateBody"].(string)
+			if err := yaml.Unmarshal([]byte(body), &templateBody); err != nil {
+				return nil, err
+			}
+			props := templateBody.Resources.NodeGroup.Properties
+			profile := launchConfigProfiles[props.LaunchConfigurationName]
+			add(nodeGroupClusterName(props.Tags), roleARNs[profileRoles[profile]])
+		case res.Type.String() == "aws:eks/nodeGroup:NodeGroup":
+			clusterName, _ := res.Inputs["clusterName"].(string)
+			nodeRoleARN, _ := res.Inputs["nodeRoleArn"].(string)
+			add(clusterName, nodeRoleARN)
+		case res.Type.String() == "aws:iam/role:Role":
+			// The default instance role is the role of the instanceRole
+			// ServiceRole of the Cluster component.
+			serviceRole := res.Parent
+			if serviceRole == "" || serviceRole.Type() != "eks:index:ServiceRole" ||
+				!strings.HasSuffix(string(serviceRole.Name()), "-instanceRole") {
+				continue
+			}
+			add(componentClusters[parents[serviceRole]], stringOutput(res, "arn"))
+		}
+	}
+
+	for _, arns := range clusterToNodeRoles {
+		sort.Strings(arns)
+	}
+	return clusterToNodeRoles, nil
+}
+
+// mapComponentToClusterName maps the URN of each Cluster component in the
+// stack to the name of its EKS cluster.
+func mapComponentToClusterName(resources []apitype.ResourceV3) map[resource.URN]string {
+	componentClusters := make(map[resource.URN]string)
+	for _, res := range resources {
+		if res.Type.String() == "aws:eks/cluster:Cluster" && res.Parent != "" &&
+			res.Parent.Type() == "eks:index:Cluster" {
+			componentClusters[res.Parent] = stringOutput(res, "name")
+		}
+	}
+	return componentClusters
+}
+
+// stringOutput returns the string output of a resource, or "" if it has none.
+func stringOutput(res apitype.ResourceV3, key string) string {
+	s, _ := res.Outputs[key].(string)
+	return s
+}
+
+// DeclaredAWSAuth returns the aws-auth entries that the Cluster component
+// declared for the named cluster in the stack, i.e. its roleMappings,
+// userMappings and instance role mappings, or nil if the stack declares no
+// aws-auth ConfigMap for the cluster.
+//
+// The inputs of the Cluster component are not recorded in the stack, so the
+// entries are read from the ConfigMap resource that it renders them into.
+func DeclaredAWSAuth(resources []apitype.ResourceV3, clusterName string) (*AWSAuth, error) {
+	componentClusters := mapComponentToClusterName(resources)
+	for _, res := range resources {
+		if res.Type.String() != "kubernetes:core/v1:ConfigMap" || res.Parent == "" ||
+			componentClusters[res.Parent] != clusterName {
+			continue
+		}
+		props := res.Inputs
+		if len(props) == 0 {
+			props = res.Outputs
+		}
+		if metadata, _ := props["metadata"].(map[string]interface{}); metadata["name"] != "aws-auth" {
+			continue
+		}
+
+		configMap := &corev1.ConfigMap{Data: make(map[string]string)}
+		data, _ := props["data"].(map[string]interface{})
+		for key, value := range data {
+			s, ok := unwrapSecrets(value).(string)
+			if !ok {
+				return nil, fmt.Errorf("declared aws-auth %s is not readable, export the stack with --show-secrets", key)
+			}
+			configMap.Data[key] = s
+		}
+		awsAuth, err := ParseAWSAuth(configMap)
+		if err != nil {
+			return nil, fmt.Errorf("declared aws-auth of cluster %q: %w", clusterName, err)
+		}
+		return awsAuth, nil
+	}
+	return nil, nil
+}
+
+// AWSAuthDiff lists the differences between the aws-auth entries declared in
+// the stack and those of the live ConfigMap. Entries are described by the
+// kind and ARN of their IAM identity, e.g. "role arn:aws:iam::...".
+type AWSAuthDiff struct {
+	// Missing are the declared entries that are not in the live ConfigMap.
+	Missing []string
+	// Extra are the live entries that were not declared, e.g. entries
+	// added by eksctl or by hand.
+	Extra []string
+	// Changed are the entries whose username or groups differ.
+	Changed []string
+}
+
+// DiffAWSAuth compares the declared aws-auth entries with the live ones,
+// matching entries by ARN. The order of groups is not significant.
+func DiffAWSAuth(declared, live *AWSAuth) AWSAuthDiff {
+	var diff AWSAuthDiff
+	diff.add("role", roleEntries(declared.MapRoles), roleEntries(live.MapRoles))
+	diff.add("user", userEntries(declared.MapUsers), userEntries(live.MapUsers))
+	return diff
+}
+
+// Drifted reports whether declared entries are missing from, or changed in,
+// the live ConfigMap. Extra entries are not drift, as the ConfigMap may be
+// shared with other tools.
+func (d AWSAuthDiff) Drifted() bool {
+	return len(d.Missing) > 0 || len(d.Changed) > 0
+}
+
+// String formats the differences as "missing: ...; extra: ...; changed: ...".
+func (d AWSAuthDiff) String() string {
+	var parts []string
+	if len(d.Missing) > 0 {
+		parts = append(parts, "missing: "+strings.Join(d.Missing, ", "))
+	}
+	if len(d.Extra) > 0 {
+		parts = append(parts, "extra: "+strings.Join(d.Extra, ", "))
+	}
+	if len(d.Changed) > 0 {
+		parts = append(parts, "changed: "+strings.Join(d.Changed, ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// add diffs the declared and live entries of a kind of IAM identity.
+func (d *AWSAuthDiff) add(kind string, declared, live map[string]awsAuthEntry) {
+	for _, arn := range sortedEntryARNs(declared) {
+		liveEntry, ok := live[arn]
+		switch {
+		case !ok:
+			d.Missing = append(d.Missing, fmt.Sprintf("%s %s", kind, arn))
+		case liveEntry.String() != declared[arn].String():
+			d.Changed = append(d.Changed, fmt.Sprintf("%s %s (declared %s, live %s)",
+				kind, arn, declared[arn], liveEntry))
+		}
+	}
+	for _, arn := range sortedEntryARNs(live) {
+		if _, ok := declared[arn]; !ok {
+			d.Extra = append(d.Extra, fmt.Sprintf("%s %s", kind, arn))
+		}
+	}
+}
+
+// awsAuthEntry is the Kubernetes identity an IAM identity is mapped to.
+type awsAuthEntry struct {
+	username string
+	groups   []string
+}
+
+func newAWSAuthEntry(username string, groups []string) awsAuthEntry {
+	sorted := append([]string(nil), groups...)
+	sort.Strings(sorted)
+	return awsAuthEntry{username: username, groups: sorted}
+}
+
+func (e awsAuthEntry) String() string {
+	return fmt.Sprintf("username %s, groups [%s]", e.username, strings.Join(e.groups, " "))
+}
+
+func roleEntries(mappings []AWSAuthRoleMapping) map[string]awsAuthEntry {
+	entries := make(map[string]awsAuthEntry, len(mappings))
+	for _, m := range mappings {
+		entries[m.RoleARN] = newAWSAuthEntry(m.Username, m.Groups)
+	}
+	return entries
+}
+
+func userEntries(mappings []AWSAuthUserMapping) map[string]awsAuthEntry {
+	entries := make(map[string]awsAuthEntry, len(mappings))
+	for _, m := range mappings {
+		entries[m.UserARN] = newAWSAuthEntry(m.Username, m.Groups)
+	}
+	return entries
+}
+
+func sortedEntryARNs(entries map[string]awsAuthEntry) []string {
+	arns := make([]string, 0, len(entries))
+	for arn := range entries {
+		arns = append(arns, arn)
+	}
+	sort.Strings(arns)
+	return arns
+}
+
+// WaitForAWSAuthMappings waits for the EKS aws-auth ConfigMap to have the
+// declared entries, polling with the default backoff. Extra entries are
+// logged, but do not fail the wait.
+func WaitForAWSAuthMappings(ctx context.Context, logger Logger, clientset kubernetes.Interface,
+	declared *AWSAuth) (ReadinessStatus, error) {
+	return waitForAWSAuthMappings(ctx, logger, DefaultSmokeTestOptions().newBackoff(), clientset, declared)
+}
+
+func waitForAWSAuthMappings(ctx context.Context, logger Logger, b *backoff, clientset kubernetes.Interface,
+	declared *AWSAuth) (ReadinessStatus, error) {
+	configMapName, namespace := "aws-auth", "kube-system"
+	o := ObjectStatus{Kind: "ConfigMap", Namespace: namespace, Name: configMapName}
+
+	var diff AWSAuthDiff
+	err := waitUntil(ctx, logger, b, fmt.Sprintf("ConfigMap %q", configMapName), "in sync with the stack",
+		func() (bool, error) {
+			configMap, err := clientset.CoreV1().ConfigMaps(namespace).Get(configMapName, metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			// Invalid entries are reported by the aws-auth check, and can
+			// still be diffed.
+			live, err := ParseAWSAuth(configMap)
+			if live == nil {
+				return false, err
+			}
+			diff = DiffAWSAuth(declared, live)
+			if diff.Drifted() {
+				return false, fmt.Errorf("%s", diff)
+			}
+			return true, nil
+		})
+	o.Reason = diff.String()
+	if err != nil {
+		return ReadinessStatus{Objects: []ObjectStatus{o}}, err
+	}
+
+	o.Ready = true
+	if len(diff.Extra) > 0 {
+		logger.Logf("EKS ConfigMap %q has entries that are not declared in the stack: %s\n",
+			configMapName, strings.Join(diff.Extra, ", "))
+	}
+	logger.Logf("EKS ConfigMap %q has the %d role and %d user entries declared in the stack\n",
+		configMapName, len(declared.MapRoles), len(declared.MapUsers))
+	return ReadinessStatus{Objects: []ObjectStatus{o}}, nil
+}
+
+// AWSAuthMappingsCheck ensures that the roleMappings, userMappings and
+// instance role mappings that the Cluster component declared in the stack
+// are in the live aws-auth ConfigMap. It passes if the stack declares no
+// aws-auth ConfigMap for the cluster, e.g. when no stack resources are given.
+func AWSAuthMappingsCheck() Check {
+	return &readinessCheck{
+		name:      AWSAuthMappingsCheckName,
+		dependsOn: []string{AWSAuthCheckName},
+		wait: func(ctx context.Context, env *CheckEnv) (ReadinessStatus, error) {
+			declared, err := DeclaredAWSAuth(env.Resources, env.ClusterName)
+			if err != nil {
+				return ReadinessStatus{}, err
+			}
+			if declared == nil {
+				env.Logger.Logf("No aws-auth ConfigMap is declared in the stack for cluster %q\n", env.ClusterName)
+				return ReadinessStatus{}, nil
+			}
+			return waitForAWSAuthMappings(ctx, env.Logger, env.Options.newBackoff(), env.KubeAccess.Clientset,
+				declared)
+		},
+	}
+}
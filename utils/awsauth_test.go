@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapClusterToNodeRoles(t *testing.T) {
+	export, err := LoadStackExport(testStackExport)
+	require.NoError(t, err)
+
+	clusterToNodeRoles, err := mapClusterToNodeRoles(export.Resources)
+	require.NoError(t, err)
+	assert.Equal(t, clusterNodeRolesMap{
+		// The default instance role, used by the default node group.
+		"example-cluster-eksCluster-5f0e9c1": {
+			"arn:aws:iam::123456789012:role/example-cluster-instanceRole-role-8a4c2e6",
+		},
+		// The role of the instance profile of the self-managed node group,
+		// and the nodeRoleArn of the managed node group.
+		"example-advanced-eksCluster-2b7d4a8": {
+			"arn:aws:iam::123456789012:role/example-role1-5a1b3c7",
+			"arn:aws:iam::123456789012:role/example-role2-9e2d4f6",
+		},
+	}, clusterToNodeRoles)
+}
+
+func TestDeclaredAWSAuth(t *testing.T) {
+	export, err := LoadStackExport(testStackExport)
+	require.NoError(t, err)
+
+	awsAuth, err := DeclaredAWSAuth(export.Resources, "example-cluster-eksCluster-5f0e9c1")
+	require.NoError(t, err)
+	assert.Equal(t, &AWSAuth{
+		MapRoles: []AWSAuthRoleMapping{
+			{RoleARN: "arn:aws:iam::123456789012:role/admins", Username: "admin", Groups: []string{"system:masters"}},
+			{RoleARN: "arn:aws:iam::123456789012:role/example-cluster-instanceRole-role-8a4c2e6",
+				Username: "system:node:{{EC2PrivateDNSName}}", Groups: []string{"system:bootstrappers", "system:nodes"}},
+		},
+		MapUsers: []AWSAuthUserMapping{
+			{UserARN: "arn:aws:iam::123456789012:user/alice", Username: "alice", Groups: []string{"dev"}},
+		},
+	}, awsAuth)
+
+	awsAuth, err = DeclaredAWSAuth(export.Resources, "example-advanced-eksCluster-2b7d4a8")
+	require.NoError(t, err)
+	assert.Len(t, awsAuth.MapRoles, 2)
+	assert.Empty(t, awsAuth.MapUsers)
+
+	awsAuth, err = DeclaredAWSAuth(export.Resources, "unknown")
+	assert.NoError(t, err)
+	assert.Nil(t, awsAuth)
+
+	// Secrets of a stack exported without --show-secrets cannot be read.
+	encrypted, err := ParseStackExport([]byte(`{"version": 3, "deployment": {"resources": [
+		{"urn": "urn:pulumi:dev::p::eks:index:Cluster::c", "type": "eks:index:Cluster"},
+		{"urn": "urn:pulumi:dev::p::eks:index:Cluster$aws:eks/cluster:Cluster::c-eksCluster",
+			"type": "aws:eks/cluster:Cluster", "parent": "urn:pulumi:dev::p::eks:index:Cluster::c",
+			"outputs": {"name": "c-eksCluster-1234567"}},
+		{"urn": "urn:pulumi:dev::p::eks:index:Cluster$kubernetes:core/v1:ConfigMap::c-nodeAccess",
+			"type": "kubernetes:core/v1:ConfigMap", "parent": "urn:pulumi:dev::p::eks:index:Cluster::c",
+			"inputs": {"metadata": {"name": "aws-auth", "namespace": "kube-system"}, "data": {
+				"mapRoles": {"4dabf18193072939515e22adb298388d": "1b47061264138c4ac30d75fd1eb44270",
+					"ciphertext": "v1:abc"}}}}]}}`))
+	require.NoError(t, err)
+	_, err = DeclaredAWSAuth(encrypted.Resources, "c-eksCluster-1234567")
+	assert.EqualError(t, err, "declared aws-auth mapRoles is not readable, export the stack with --show-secrets")
+}
+
+func TestDiffAWSAuth(t *testing.T) {
+	const (
+		admins = "arn:aws:iam::123456789012:role/admins"
+		nodes  = "arn:aws:iam::123456789012:role/nodes"
+		alice  = "arn:aws:iam::123456789012:user/alice"
+	)
+	declared := &AWSAuth{
+		MapRoles: []AWSAuthRoleMapping{
+			{RoleARN: admins, Username: "admin", Groups: []string{"system:masters"}},
+			{RoleARN: nodes, Username: "system:node:{{EC2PrivateDNSName}}", Groups: nodeGroups},
+		},
+		MapUsers: []AWSAuthUserMapping{
+			{UserARN: alice, Username: "alice", Groups: []string{"dev"}},
+		},
+	}
+
+	for name, tc := range map[string]struct {
+		live     *AWSAuth
+		expected AWSAuthDiff
+		drifted  bool
+		str      string
+	}{
+		"same entries in another order": {
+			live: &AWSAuth{
+				MapRoles: []AWSAuthRoleMapping{
+					{RoleARN: nodes, Username: "system:node:{{EC2PrivateDNSName}}",
+						Groups: []string{"system:nodes", "system:bootstrappers"}},
+					{RoleARN: admins, Username: "admin", Groups: []string{"system:masters"}},
+				},
+				MapUsers: []AWSAuthUserMapping{{UserARN: alice, Username: "alice", Groups: []string{"dev"}}},
+			},
+		},
+		"missing entries": {
+			live: &AWSAuth{
+				MapRoles: []AWSAuthRoleMapping{
+					{RoleARN: nodes, Username: "system:node:{{EC2PrivateDNSName}}", Groups: nodeGroups},
+				},
+			},
+			expected: AWSAuthDiff{Missing: []string{"role " + admins, "user " + alice}},
+			drifted:  true,
+			str:      "missing: role " + admins + ", user " + alice,
+		},
+		// Entries added by other tools are not drift.
+		"extra entries": {
+			live: &AWSAuth{
+				MapRoles: append(append([]AWSAuthRoleMapping(nil), declared.MapRoles...),
+					AWSAuthRoleMapping{RoleARN: "arn:aws:iam::123456789012:role/eksctl-ng", Username: "eksctl",
+						Groups: nodeGroups}),
+				MapUsers: append(append([]AWSAuthUserMapping(nil), declared.MapUsers...),
+					AWSAuthUserMapping{UserARN: "arn:aws:iam::123456789012:user/bob", Username: "bob",
+						Groups: []string{"dev"}}),
+			},
+			expected: AWSAuthDiff{Extra: []string{
+				"role arn:aws:iam::123456789012:role/eksctl-ng",
+				"user arn:aws:iam::123456789012:user/bob",
+			}},
+			str: "extra: role arn:aws:iam::123456789012:role/eksctl-ng, user arn:aws:iam::123456789012:user/bob",
+		},
+		"changed entries": {
+			live: &AWSAuth{
+				MapRoles: []AWSAuthRoleMapping{
+					{RoleARN: admins, Username: "admin", Groups: []string{"system:masters", "dev"}},
+					{RoleARN: nodes, Username: "node", Groups: nodeGroups},
+				},
+				MapUsers: declared.MapUsers,
+			},
+			expected: AWSAuthDiff{Changed: []string{
+				"role " + admins + " (declared username admin, groups [system:masters], " +
+					"live username admin, groups [dev system:masters])",
+				"role " + nodes + " (declared username system:node:{{EC2PrivateDNSName}}, " +
+					"groups [system:bootstrappers system:nodes], live username node, " +
+					"groups [system:bootstrappers system:nodes])",
+			}},
+			drifted: true,
+		},
+		"empty ConfigMap": {
+			live:     &AWSAuth{},
+			expected: AWSAuthDiff{Missing: []string{"role " + admins, "role " + nodes, "user " + alice}},
+			drifted:  true,
+		},
+	} {
+		diff := DiffAWSAuth(declared, tc.live)
+		assert.Equal(t, tc.expected, diff, name)
+		assert.Equal(t, tc.drifted, diff.Drifted(), name)
+		if tc.str != "" {
+			assert.Equal(t, tc.str, diff.String(), name)
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pulumi/pulumi/sdk/v2/go/common/apitype"
+)
+
+// Check is a single validation run by the EKS smoke test against a cluster.
+type Check interface {
+	// Name uniquely identifies the check, e.g. "nodes".
+	Name() string
+	// DependsOn lists the names of the checks that must pass before this
+	// check is run.
+	DependsOn() []string
+	// Run validates the cluster described by env. Run should return once ctx
+	// is done.
+	Run(ctx context.Context, env *CheckEnv) CheckResult
+}
+
+// CheckEnv is the cluster, and the Pulumi stack that created it, that a Check
+// is run against.
+type CheckEnv struct {
+	// ClusterName is the name of the EKS cluster.
+	ClusterName string
+	// KubeAccess is the client-go tool bag of the cluster.
+	KubeAccess *KubeAccess
+	// Resources are the Pulumi stack resources.
+	Resources []apitype.ResourceV3
+	// DesiredNodeCount is the total desired worker Node count of the cluster
+	// across all of its NodeGroups.
+	DesiredNodeCount int
+	// NodeGroups are the node groups of the cluster, and their desired Node
+	// counts.
+	NodeGroups []NodeGroup
+	// NodeRoleARNs are the ARNs of the IAM roles of the worker Nodes of the
+	// cluster, which must be mapped in the aws-auth ConfigMap.
+	NodeRoleARNs []string
+	// Options are the options the smoke test is run with.
+	Options SmokeTestOptions
+	// Logger receives the progress of the check.
+	Logger Logger
+}
+
+// CheckStatus is the outcome of a Check.
+type CheckStatus string
+
+const (
+	// CheckPassed is the status of a check that succeeded.
+	CheckPassed CheckStatus = "passed"
+	// CheckFailed is the status of a check that returned an error.
+	CheckFailed CheckStatus = "failed"
+	// CheckSkipped is the status of a check that was not run because one of
+	// its dependencies did not pass.
+	CheckSkipped CheckStatus = "skipped"
+)
+
+// CheckResult is the result of running a Check.
+type CheckResult struct {
+	// Name is the name of the check. It is set by the smoke test.
+	Name string
+	// Status is the outcome of the check. It is set by the smoke test from Err.
+	Status CheckStatus
+	// Duration is how long the check took. It is set by the smoke test.
+	Duration time.Duration
+	// Err is the reason the check failed, if it did.
+	Err error
+	// Message is an optional summary of the result.
+	Message string
+	// Objects are the Kubernetes objects inspected by the check, and their
+	// readiness.
+	Objects []ObjectStatus
+}
+
+// checkFunc is a Check implemented by a function.
+type checkFunc struct {
+	name      string
+	dependsOn []string
+	run       func(ctx context.Context, env *CheckEnv) error
+}
+
+func (c *checkFunc) Name() string        { return c.name }
+func (c *checkFunc) DependsOn() []string { return c.dependsOn }
+
+func (c *checkFunc) Run(ctx context.Context, env *CheckEnv) CheckResult {
+	return CheckResult{Err: c.run(ctx, env)}
+}
+
+// NewCheck creates a Check from a function that returns an error if the
+// cluster fails the check.
+func NewCheck(name string, dependsOn []string, run func(ctx context.Context, env *CheckEnv) error) Check {
+	return &checkFunc{name: name, dependsOn: dependsOn, run: run}
+}
+
+// readinessCheck is a Check that waits on the readiness of a set of objects,
+// and reports them in its result.
+type readinessCheck struct {
+	name      string
+	dependsOn []string
+	wait      func(ctx context.Context, env *CheckEnv) (ReadinessStatus, error)
+}
+
+func (c *readinessCheck) Name() string        { return c.name }
+func (c *readinessCheck) DependsOn() []string { return c.dependsOn }
+
+func (c *readinessCheck) Run(ctx context.Context, env *CheckEnv) CheckResult {
+	status, err := c.wait(ctx, env)
+	return CheckResult{Err: err, Objects: status.Objects}
+}
+
+// AWSAuthCheck ensures that the EKS aws-auth ConfigMap exists, that its
+// mapRoles and mapUsers are valid, and that the IAM roles of the worker Nodes
+// of the cluster are mapped to the Node groups.
+func AWSAuthCheck() Check {
+	return &readinessCheck{
+		name: AWSAuthCheckName,
+		wait: func(ctx context.Context, env *CheckEnv) (ReadinessStatus, error) {
+			return waitForEKSConfigMap(ctx, env.Logger, env.Options.newBackoff(), env.KubeAccess.Clientset,
+				env.NodeRoleARNs)
+		},
+	}
+}
+
+// NodesCheck ensures that the desired worker Node count of the cluster are
+// running & have a "Ready" status condition. The desired count of each node
+// group is checked on its own, so that a failed group is not masked by a
+// larger one, unless the node groups of the cluster are unknown.
+func NodesCheck() Check {
+	return &readinessCheck{
+		name: NodesCheckName,
+		wait: func(ctx context.Context, env *CheckEnv) (ReadinessStatus, error) {
+			if len(env.NodeGroups) > 0 {
+				return waitForNodeGroupsReady(ctx, env.Logger, env.Options.newBackoff(), env.KubeAccess.Clientset,
+					env.NodeGroups, env.Options.AutoScaling)
+			}
+			return WaitForAllNodesReady(ctx, env.Logger, env.KubeAccess.Clientset, env.DesiredNodeCount)
+		},
+	}
+}
+
+// PodsCheck ensures that all Pods, across all namespaces, are ready. Pods are
+// filtered by the Filter of the smoke test options, whose TerminalPods policy
+// decides how Pods left behind by Node drains are evaluated.
+func PodsCheck() Check {
+	return &readinessCheck{
+		name:      PodsCheckName,
+		dependsOn: []string{NodesCheckName},
+		wait: func(ctx context.Context, env *CheckEnv) (ReadinessStatus, error) {
+			return WaitForKindsReadyWithFilter(ctx, env.Logger, env.KubeAccess.Clientset, env.Options.Filter, "pods")
+		},
+	}
+}
+
+// DaemonSetsCheck ensures that all DaemonSets, across all namespaces, e.g.
+// aws-node and kube-proxy, have rolled out to every Node they are eligible to
+// run on. DaemonSets are filtered by the Filter of the smoke test options.
+func DaemonSetsCheck() Check {
+	return &readinessCheck{
+		name:      DaemonSetsCheckName,
+		dependsOn: []string{NodesCheckName},
+		wait: func(ctx context.Context, env *CheckEnv) (ReadinessStatus, error) {
+			return WaitForKindsReadyWithFilter(ctx, env.Logger, env.KubeAccess.Clientset, env.Options.Filter,
+				"daemonsets")
+		},
+	}
+}
+
+// HTTPCheck ensures that an HTTP endpoint, e.g. a Service exported by the
+// stack, responds successfully within maxWait, and that its response body
+// passes check.
+func HTTPCheck(name string, endpoint string, headers map[string]string, maxWait time.Duration,
+	check func(body string) bool) Check {
+	return NewCheck(name, nil, func(ctx context.Context, env *CheckEnv) error {
+		body, err := GetHTTPBodyWithRetry(ctx, env.Logger, endpoint, headers, maxWait)
+		if err != nil {
+			return err
+		}
+		if !check(body) {
+			return fmt.Errorf("response body of %s did not pass the check: %q", endpoint, body)
+		}
+		return nil
+	})
+}
+
+// CheckRegistry is an ordered set of Checks for the smoke test to run.
+type CheckRegistry struct {
+	checks   map[string]Check
+	order    []string
+	disabled map[string]bool
+}
+
+// NewCheckRegistry creates an empty CheckRegistry.
+func NewCheckRegistry() *CheckRegistry {
+	return &CheckRegistry{
+		checks:   make(map[string]Check),
+		disabled: make(map[string]bool),
+	}
+}
+
+// DefaultCheckRegistry creates a CheckRegistry of the default smoke test
+// checks: the aws-auth ConfigMap, Node readiness and Pod readiness. The
+// control plane health, APIService availability, declared aws-auth entries,
+// Node health and DaemonSet rollout checks are registered, but disabled, so
+// that they are opt-in with Enable.
+func DefaultCheckRegistry() *CheckRegistry {
+	r := NewCheckRegistry()
+	if err := r.Register(ControlPlaneCheck(), APIServicesCheck(), AWSAuthCheck(), AWSAuthMappingsCheck(),
+		NodesCheck(), NodeHealthCheck(), DaemonSetsCheck(), PodsCheck()); err != nil {
+		panic(err)
+	}
+	r.Disable(ControlPlaneCheckName, APIServicesCheckName, AWSAuthMappingsCheckName, NodeHealthCheckName,
+		DaemonSetsCheckName)
+	return r
+}
+
+// Register adds checks to the registry. Check names must be unique.
+func (r *CheckRegistry) Register(checks ...Check) error {
+	for _, check := range checks {
+		name := check.Name()
+		if _, ok := r.checks[name]; ok {
+			return fmt.Errorf("check %q is already registered", name)
+		}
+		r.checks[name] = check
+		r.order = append(r.order, name)
+	}
+	return nil
+}
+
+// Names returns the names of all registered checks, enabled or not, in order
+// of registration.
+func (r *CheckRegistry) Names() []string {
+	return append([]string(nil), r.order...)
+}
+
+// Enabled returns the names of the enabled checks, in order of registration.
+func (r *CheckRegistry) Enabled() []string {
+	var names []string
+	for _, name := range r.order {
+		if !r.disabled[name] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Disable turns off the named checks. Checks that depend on a disabled
+// check are still run.
+func (r *CheckRegistry) Disable(names ...string) {
+	for _, name := range names {
+		r.disabled[name] = true
+	}
+}
+
+// Enable turns back on the named checks.
+func (r *CheckRegistry) Enable(names ...string) {
+	for _, name := range names {
+		delete(r.disabled, name)
+	}
+}
+
+// Checks returns the enabled checks, ordered so that each check comes after
+// the checks it depends on, and otherwise in order of registration.
+func (r *CheckRegistry) Checks() ([]Check, error) {
+	var ordered []Check
+	visited := make(map[string]bool)
+	visiting := make(map[string]bool)
+
+	var visit func(name string, from string) error
+	visit = func(name string, from string) error {
+		check, ok := r.checks[name]
+		if !ok {
+			return fmt.Errorf("check %q depends on unknown check %q", from, name)
+		}
+		if visited[name] {
+			return nil
+		}
+		if visiting[name] {
+			return fmt.Errorf("checks %q and %q have a circular dependency", from, name)
+		}
+		visiting[name] = true
+		for _, dep := range check.DependsOn() {
+			if err := visit(dep, name); err != nil {
+				return err
+			}
+		}
+		visiting[name] = false
+		visited[name] = true
+		if !r.disabled[name] {
+			ordered = append(ordered, check)
+		}
+		return nil
+	}
+
+	for _, name := range r.order {
+		if err := visit(name, ""); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// runChecks runs the checks in order against env. A check is skipped if any
+// of its dependencies failed or were skipped.
+func runChecks(checks []Check, env *CheckEnv) []CheckResult {
+	statuses := make(map[string]CheckStatus)
+	results := make([]CheckResult, 0, len(checks))
+	for _, check := range checks {
+		var result CheckResult
+		if dep := unmetDependency(check, statuses); dep != "" {
+			result = CheckResult{
+				Name:    check.Name(),
+				Status:  CheckSkipped,
+				Message: fmt.Sprintf("dependency %q did not pass", dep),
+			}
+			env.Logger.Logf("Check %q skipped: %s\n", result.Name, result.Message)
+		} else {
+			result = runCheck(check, env)
+		}
+		statuses[result.Name] = result.Status
+		results = append(results, result)
+	}
+	return results
+}
+
+// unmetDependency returns the name of the first dependency of check that did
+// not pass, if any. Dependencies that were not run are ignored.
+func unmetDependency(check Check, statuses map[string]CheckStatus) string {
+	for _, dep := range check.DependsOn() {
+		if status, ok := statuses[dep]; ok && status != CheckPassed {
+			return dep
+		}
+	}
+	return ""
+}
+
+// runCheck runs a single check bounded by its own deadline, and logs how long
+// it took.
+func runCheck(check Check, env *CheckEnv) CheckResult {
+	ctx, cancel := context.WithTimeout(env.Options.Context, env.Options.timeoutFor(check.Name()))
+	defer cancel()
+
+	start := time.Now()
+	result := check.Run(ctx, env)
+	result.Name = check.Name()
+	result.Duration = time.Since(start)
+	if result.Err != nil {
+		result.Status = CheckFailed
+	} else {
+		result.Status = CheckPassed
+	}
+
+	env.Logger.Logf("Check %q %s in %v\n", result.Name, result.Status, result.Duration.Round(time.Millisecond))
+	return result
+}
@@ -0,0 +1,150 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubCheck returns a Check that records that it ran, and fails with err.
+func stubCheck(name string, err error, ran map[string]bool, dependsOn ...string) Check {
+	return NewCheck(name, dependsOn, func(context.Context, *CheckEnv) error {
+		ran[name] = true
+		return err
+	})
+}
+
+// checkNames returns the names of checks.
+func checkNames(checks []Check) []string {
+	var names []string
+	for _, check := range checks {
+		names = append(names, check.Name())
+	}
+	return names
+}
+
+func TestCheckRegistryChecks(t *testing.T) {
+	ran := make(map[string]bool)
+	r := NewCheckRegistry()
+	require.NoError(t, r.Register(
+		stubCheck("pods", nil, ran, "nodes"),
+		stubCheck("http", nil, ran, "pods", "aws-auth"),
+		stubCheck("nodes", nil, ran, "aws-auth"),
+		stubCheck("aws-auth", nil, ran),
+		stubCheck("extra", nil, ran),
+	))
+	assert.EqualError(t, r.Register(stubCheck("nodes", nil, ran)), `check "nodes" is already registered`)
+
+	// Dependencies come first, and otherwise the order of registration.
+	checks, err := r.Checks()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"aws-auth", "nodes", "pods", "http", "extra"}, checkNames(checks))
+
+	// Disabled checks are left out, without dropping their dependents.
+	r.Disable("nodes", "extra")
+	checks, err = r.Checks()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"aws-auth", "pods", "http"}, checkNames(checks))
+	assert.Equal(t, []string{"pods", "http", "aws-auth"}, r.Enabled())
+	assert.Equal(t, []string{"pods", "http", "nodes", "aws-auth", "extra"}, r.Names())
+
+	r.Enable("extra")
+	checks, err = r.Checks()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"aws-auth", "pods", "http", "extra"}, checkNames(checks))
+	assert.Empty(t, ran)
+}
+
+func TestCheckRegistryChecksErrors(t *testing.T) {
+	ran := make(map[string]bool)
+	for name, tc := range map[string]struct {
+		checks []Check
+		err    string
+	}{
+		"unknown dependency": {
+			checks: []Check{stubCheck("pods", nil, ran, "nodes")},
+			err:    `check "pods" depends on unknown check "nodes"`,
+		},
+		"unknown dependency of a disabled check": {
+			checks: []Check{stubCheck("disabled", nil, ran, "missing")},
+			err:    `check "disabled" depends on unknown check "missing"`,
+		},
+		"cycle": {
+			checks: []Check{
+				stubCheck("a", nil, ran, "c"),
+				stubCheck("b", nil, ran, "a"),
+				stubCheck("c", nil, ran, "b"),
+			},
+			err: `checks "b" and "a" have a circular dependency`,
+		},
+		"self dependency": {
+			checks: []Check{stubCheck("a", nil, ran, "a")},
+			err:    `checks "a" and "a" have a circular dependency`,
+		},
+	} {
+		r := NewCheckRegistry()
+		require.NoError(t, r.Register(tc.checks...), name)
+		r.Disable("disabled")
+		_, err := r.Checks()
+		assert.EqualError(t, err, tc.err, name)
+	}
+}
+
+func TestRunChecks(t *testing.T) {
+	ran := make(map[string]bool)
+	r := NewCheckRegistry()
+	require.NoError(t, r.Register(
+		stubCheck("aws-auth", errors.New("aws-auth ConfigMap not found"), ran),
+		stubCheck("nodes", nil, ran, "aws-auth"),
+		stubCheck("pods", nil, ran, "nodes"),
+		stubCheck("control-plane", nil, ran),
+		stubCheck("api-services", nil, ran, "control-plane"),
+		stubCheck("daemonsets", nil, ran, "disabled"),
+		stubCheck("disabled", errors.New("not run"), ran),
+	))
+	r.Disable("control-plane", "disabled")
+	checks, err := r.Checks()
+	require.NoError(t, err)
+
+	opts := DefaultSmokeTestOptions()
+	opts.Timeout = time.Minute
+	results := runChecks(checks, &CheckEnv{Options: opts, Logger: DiscardLogger})
+
+	type outcome struct {
+		name    string
+		status  CheckStatus
+		message string
+	}
+	var outcomes []outcome
+	for _, result := range results {
+		outcomes = append(outcomes, outcome{result.Name, result.Status, result.Message})
+	}
+	assert.Equal(t, []outcome{
+		{"aws-auth", CheckFailed, ""},
+		// Dependents of a failed check are skipped, and so are theirs.
+		{"nodes", CheckSkipped, `dependency "aws-auth" did not pass`},
+		{"pods", CheckSkipped, `dependency "nodes" did not pass`},
+		// Dependencies that were not run do not hold their dependents back.
+		{"api-services", CheckPassed, ""},
+		{"daemonsets", CheckPassed, ""},
+	}, outcomes)
+	assert.EqualError(t, results[0].Err, "aws-auth ConfigMap not found")
+	assert.Equal(t, map[string]bool{"aws-auth": true, "api-services": true, "daemonsets": true}, ran)
+}
+
+func TestDefaultCheckRegistry(t *testing.T) {
+	r := DefaultCheckRegistry()
+	// Checks added since the original checklist are opt-in, so that they do
+	// not change the checklist of existing smoke tests.
+	assert.Equal(t, []string{AWSAuthCheckName, NodesCheckName, PodsCheckName}, r.Enabled())
+
+	r.Enable(AWSAuthMappingsCheckName, DaemonSetsCheckName)
+	checks, err := r.Checks()
+	require.NoError(t, err)
+	assert.Equal(t, []string{AWSAuthCheckName, AWSAuthMappingsCheckName, NodesCheckName, DaemonSetsCheckName,
+		PodsCheckName}, checkNames(checks))
+}
@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pulumi/pulumi/sdk/v2/go/common/apitype"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// clusterResourceType is the type of EKS cluster resources in a Pulumi stack.
+const clusterResourceType = "aws:eks/cluster:Cluster"
+
+// defaultKubeconfigNames are the generic cluster and context names of the
+// kubeconfigs generated by the EKS package, which do not identify a cluster.
+var defaultKubeconfigNames = map[string]bool{"kubernetes": true, "aws": true}
+
+// NamedKubeconfigs maps EKS cluster names to their kubeconfigs. It can be
+// passed in place of a kubeconfig to the smoke test to name clusters
+// explicitly, rather than resolving their names with ClusterName.
+type NamedKubeconfigs map[string]interface{}
+
+// ClusterName resolves the name of the EKS cluster a kubeconfig is for, from
+// the current context of the kubeconfig. In order, it uses:
+//
+//   - the cluster name given to the exec credential plugin, e.g.
+//     `aws eks get-token --cluster-name NAME` or
+//     `aws-iam-authenticator token -i NAME`,
+//   - the EKS cluster in resources whose endpoint is the kubeconfig server,
+//   - the cluster, or context, name of the kubeconfig, or the cluster name of
+//     either if it is an EKS cluster ARN, unless it is a generic default.
+func ClusterName(kubeconfig []byte, resources []apitype.ResourceV3) (string, error) {
+	config, err := clientcmd.Load(kubeconfig)
+	if err != nil {
+		return "", err
+	}
+	contextName := config.CurrentContext
+	context, ok := config.Contexts[contextName]
+	if !ok {
+		return "", fmt.Errorf("kubeconfig current context %q does not exist", contextName)
+	}
+
+	if authInfo, ok := config.AuthInfos[context.AuthInfo]; ok && authInfo.Exec != nil {
+		if name := clusterNameFromExecArgs(authInfo.Exec.Args); name != "" {
+			return name, nil
+		}
+	}
+
+	if cluster, ok := config.Clusters[context.Cluster]; ok && cluster.Server != "" {
+		if name, ok := clusterEndpoints(resources)[normalizeEndpoint(cluster.Server)]; ok {
+			return name, nil
+		}
+	}
+
+	for _, name := range []string{context.Cluster, contextName} {
+		if name = clusterNameFromARN(name); name != "" && !defaultKubeconfigNames[name] {
+			return name, nil
+		}
+	}
+
+	return "", fmt.Errorf("unable to identify the EKS cluster of kubeconfig context %q", contextName)
+}
+
+// clusterNameFromExecArgs returns the value of the cluster name flag of the
+// `aws eks get-token` or `aws-iam-authenticator token` args, if any.
+func clusterNameFromExecArgs(args []string) string {
+	return execFlagValue(args, "--cluster-name", "--cluster-id", "-i")
+}
+
+// execFlagValue returns the value of the first of flags in the args of an exec
+// credential plugin, given as either `FLAG VALUE` or `FLAG=VALUE`, if any.
+func execFlagValue(args []string, flags ...string) string {
+	for i, arg := range args {
+		for _, flag := range flags {
+			if arg == flag && i+1 < len(args) {
+				return args[i+1]
+			}
+			if strings.HasPrefix(arg, flag+"=") {
+				return strings.TrimPrefix(arg, flag+"=")
+			}
+		}
+	}
+	return ""
+}
+
+// clusterNameFromARN returns the cluster name of an EKS cluster ARN, e.g.
+// "arn:aws:eks:us-west-2:123456789012:cluster/NAME", as used by
+// `aws eks update-kubeconfig`. Other names are returned as is.
+func clusterNameFromARN(name string) string {
+	if strings.HasPrefix(name, "arn:") {
+		if i := strings.Index(name, ":cluster/"); i >= 0 {
+			return name[i+len(":cluster/"):]
+		}
+	}
+	return name
+}
+
+// clusterEndpoints maps the normalized API Server endpoints of the EKS
+// clusters in resources to their names.
+func clusterEndpoints(resources []apitype.ResourceV3) map[string]string {
+	endpoints := make(map[string]string)
+	for _, res := range resources {
+		if res.Type.String() != clusterResourceType {
+			continue
+		}
+		endpoint, _ := res.Outputs["endpoint"].(string)
+		name, _ := res.Outputs["name"].(string)
+		if endpoint != "" && name != "" {
+			endpoints[normalizeEndpoint(endpoint)] = name
+		}
+	}
+	return endpoints
+}
+
+// normalizeEndpoint returns the endpoint as a lowercase https URL without a
+// trailing slash.
+func normalizeEndpoint(endpoint string) string {
+	endpoint = strings.TrimSuffix(strings.ToLower(endpoint), "/")
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	return endpoint
+}
+
+// serializeKubeconfig returns the kubeconfig as a serialized kubeconfig file.
+// A kubeconfig is either a serialized kubeconfig file as a []byte or string,
+// or a stack output to be serialized as JSON.
+func serializeKubeconfig(kubeconfig interface{}) ([]byte, error) {
+	switch kc := kubeconfig.(type) {
+	case []byte:
+		return kc, nil
+	case string:
+		return []byte(kc), nil
+	default:
+		return json.Marshal(kubeconfig)
+	}
+}
@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testKubeconfig returns a kubeconfig of a single cluster, context and user,
+// with the given server and user, in the layout of Cluster.getKubeconfig.
+func testKubeconfig(clusterName, contextName, server, user string) []byte {
+	return []byte(fmt.Sprintf(`{
+  "apiVersion": "v1",
+  "kind": "Config",
+  "clusters": [{"name": %q, "cluster": {"server": %q, "certificate-authority-data": "Y2E="}}],
+  "contexts": [{"name": %q, "context": {"cluster": %q, "user": "aws"}}],
+  "current-context": %q,
+  "users": [{"name": "aws", "user": %s}]
+}`, clusterName, server, contextName, clusterName, contextName, user))
+}
+
+// execUser returns a kubeconfig user of an exec credential plugin.
+func execUser(command string, args ...string) string {
+	argsJSON, _ := json.Marshal(args)
+	return fmt.Sprintf(`{"exec": {"apiVersion": "client.authentication.k8s.io/v1alpha1", "command": %q, "args": %s}}`,
+		command, argsJSON)
+}
+
+func TestClusterName(t *testing.T) {
+	export, err := LoadStackExport(testStackExport)
+	require.NoError(t, err)
+	const server = "https://example.gr7.us-west-2.eks.amazonaws.com"
+
+	for name, tc := range map[string]struct {
+		kubeconfig []byte
+		expected   string
+		err        string
+	}{
+		"aws eks get-token": {
+			kubeconfig: testKubeconfig("kubernetes", "aws", server,
+				execUser("aws", "eks", "get-token", "--cluster-name", "my-cluster", "--role-arn",
+					"arn:aws:iam::123456789012:role/admins")),
+			expected: "my-cluster",
+		},
+		"aws-iam-authenticator": {
+			kubeconfig: testKubeconfig("kubernetes", "aws", server,
+				execUser("aws-iam-authenticator", "token", "-i", "my-cluster", "-r",
+					"arn:aws:iam::123456789012:role/admins")),
+			expected: "my-cluster",
+		},
+		"flag with a value": {
+			kubeconfig: testKubeconfig("kubernetes", "aws", server,
+				execUser("aws", "--region", "us-west-2", "eks", "get-token", "--cluster-name=my-cluster")),
+			expected: "my-cluster",
+		},
+		// getKubeconfig({profileName}) sets AWS_PROFILE in the env of the
+		// exec plugin.
+		"profile": {
+			kubeconfig: testKubeconfig("kubernetes", "aws", server,
+				`{"exec": {"apiVersion": "client.authentication.k8s.io/v1alpha1", "command": "aws",
+				  "args": ["eks", "get-token", "--cluster-name", "my-cluster"],
+				  "env": [{"name": "AWS_PROFILE", "value": "dev"}]}}`),
+			expected: "my-cluster",
+		},
+		"endpoint of a stack cluster": {
+			kubeconfig: testKubeconfig("kubernetes", "aws",
+				"https://0a1b2c3d4e5f60718293a4b5c6d7e8f9.gr7.us-west-2.eks.amazonaws.com/",
+				`{"token": "static"}`),
+			expected: "example-cluster-eksCluster-5f0e9c1",
+		},
+		"ARN of aws eks update-kubeconfig": {
+			kubeconfig: testKubeconfig("arn:aws:eks:us-west-2:123456789012:cluster/my-cluster",
+				"arn:aws:eks:us-west-2:123456789012:cluster/my-cluster", server, `{"token": "static"}`),
+			expected: "my-cluster",
+		},
+		"context name": {
+			kubeconfig: testKubeconfig("kubernetes", "my-cluster", server, `{"token": "static"}`),
+			expected:   "my-cluster",
+		},
+		// A static token has no exec plugin, and the generic names of
+		// getKubeconfig do not identify a cluster.
+		"static token with generic names": {
+			kubeconfig: testKubeconfig("kubernetes", "aws", server, `{"token": "static"}`),
+			err:        `unable to identify the EKS cluster of kubeconfig context "aws"`,
+		},
+		"exec plugin without a cluster name": {
+			kubeconfig: testKubeconfig("kubernetes", "aws", server, execUser("get-token.sh")),
+			err:        `unable to identify the EKS cluster of kubeconfig context "aws"`,
+		},
+		"missing current context": {
+			kubeconfig: []byte(`{"apiVersion": "v1", "kind": "Config", "current-context": "aws"}`),
+			err:        `kubeconfig current context "aws" does not exist`,
+		},
+	} {
+		clusterName, err := ClusterName(tc.kubeconfig, export.Resources)
+		if tc.err != "" {
+			assert.EqualError(t, err, tc.err, name)
+			continue
+		}
+		if assert.NoError(t, err, name) {
+			assert.Equal(t, tc.expected, clusterName, name)
+		}
+	}
+}
+
+func TestExecFlagValue(t *testing.T) {
+	for _, tc := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"eks", "get-token", "--cluster-name", "a", "--role-arn", "b"}, "a"},
+		{[]string{"token", "-i", "a", "-r", "b"}, "a"},
+		{[]string{"token", "--cluster-id=a"}, "a"},
+		{[]string{"eks", "get-token", "--cluster-name=a"}, "a"},
+		// A flag without a value is ignored.
+		{[]string{"eks", "get-token", "--cluster-name"}, ""},
+		{[]string{"eks", "get-token"}, ""},
+		{nil, ""},
+	} {
+		assert.Equal(t, tc.expected, execFlagValue(tc.args, "--cluster-name", "--cluster-id", "-i"), "%q", tc.args)
+	}
+}
+
+func TestClusterNameFromARN(t *testing.T) {
+	assert.Equal(t, "my-cluster", clusterNameFromARN("arn:aws:eks:us-west-2:123456789012:cluster/my-cluster"))
+	assert.Equal(t, "my-cluster", clusterNameFromARN("arn:aws-cn:eks:cn-north-1:123456789012:cluster/my-cluster"))
+	assert.Equal(t, "my-cluster", clusterNameFromARN("my-cluster"))
+	assert.Equal(t, "arn:aws:iam::123456789012:role/admins",
+		clusterNameFromARN("arn:aws:iam::123456789012:role/admins"))
+}
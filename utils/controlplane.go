@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// apiServicesResource is the resource of the aggregated APIs registered with
+// the API Server, e.g. v1beta1.metrics.k8s.io.
+var apiServicesResource = schema.GroupVersionResource{
+	Group:    "apiregistration.k8s.io",
+	Version:  "v1",
+	Resource: "apiservices",
+}
+
+// HealthStatus is the result of querying a health endpoint of the API Server,
+// e.g. /readyz, with verbose output.
+type HealthStatus struct {
+	// Endpoint is the path that was queried. It is /healthz if the API
+	// Server does not serve the endpoint that was requested.
+	Endpoint string
+	// Healthy reports whether the endpoint returned a successful status.
+	Healthy bool
+	// Failed lists the individual checks that failed, e.g. "etcd".
+	Failed []string
+	// Output is the verbose output of the endpoint.
+	Output string
+}
+
+// QueryHealthEndpoint queries a health endpoint of the API Server, e.g.
+// /readyz or /livez, with verbose output. API Servers older than 1.16 do not
+// serve /readyz or /livez, in which case /healthz is queried instead.
+func QueryHealthEndpoint(clientset kubernetes.Interface, endpoint string) (HealthStatus, error) {
+	restClient := clientset.Discovery().RESTClient()
+	if restClient == nil {
+		return HealthStatus{}, fmt.Errorf("the clientset has no REST client to query %s", endpoint)
+	}
+
+	status := HealthStatus{Endpoint: endpoint}
+	body, err := restClient.Get().AbsPath(endpoint).Param("verbose", "").DoRaw()
+	if apierrors.IsNotFound(err) && endpoint != "/healthz" {
+		status.Endpoint = "/healthz"
+		body, err = restClient.Get().AbsPath(status.Endpoint).Param("verbose", "").DoRaw()
+	}
+	status.Output = string(body)
+	status.Failed = failedHealthChecks(status.Output)
+
+	// Failing checks are reported with a 500 status, and the verbose output
+	// as the body.
+	if err != nil && len(body) == 0 {
+		return status, err
+	}
+	status.Healthy = err == nil && len(status.Failed) == 0
+	return status, nil
+}
+
+// failedHealthChecks parses the checks that failed from the verbose output of
+// a health endpoint, e.g. "[-]etcd failed: reason withheld".
+func failedHealthChecks(output string) []string {
+	var failed []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[-]") {
+			failed = append(failed, strings.TrimPrefix(line, "[-]"))
+		}
+	}
+	return failed
+}
+
+// ControlPlaneCheck ensures that the /livez and /readyz health endpoints of the
+// API Server report that all of their checks pass. It is disabled in the
+// DefaultCheckRegistry.
+func ControlPlaneCheck() Check {
+	return NewCheck(ControlPlaneCheckName, nil, func(ctx context.Context, env *CheckEnv) error {
+		clientset := env.KubeAccess.Clientset
+		for _, endpoint := range []string{"/livez", "/readyz"} {
+			var last HealthStatus
+			err := waitUntil(ctx, env.Logger, env.Options.newBackoff(), "API Server "+endpoint, "healthy",
+				func() (bool, error) {
+					status, err := QueryHealthEndpoint(clientset, endpoint)
+					if err != nil {
+						return false, err
+					}
+					last = status
+					if !status.Healthy {
+						return false, fmt.Errorf("failed checks: %s", strings.Join(status.Failed, ", "))
+					}
+					return true, nil
+				})
+			if err != nil {
+				return err
+			}
+			env.Logger.Logf("API Server %s is healthy\n", last.Endpoint)
+		}
+		return nil
+	})
+}
+
+// DiscoveryFailures returns the API group versions whose discovery failed,
+// e.g. due to an unavailable aggregated API, and why.
+func DiscoveryFailures(client discovery.DiscoveryInterface) (map[string]error, error) {
+	_, _, err := client.ServerGroupsAndResources()
+	if err == nil {
+		return nil, nil
+	}
+	groupErr, ok := err.(*discovery.ErrGroupDiscoveryFailed)
+	if !ok {
+		return nil, err
+	}
+	failures := make(map[string]error, len(groupErr.Groups))
+	for gv, err := range groupErr.Groups {
+		failures[gv.String()] = err
+	}
+	return failures, nil
+}
+
+// APIServicesCheck ensures that every APIService registered with the API
+// Server is Available, and that API discovery returns all groups. A broken
+// aggregated API breaks namespace deletion and kubectl. It is disabled in the
+// DefaultCheckRegistry, as a stale APIService of an add-on would fail clusters
+// that are otherwise healthy.
+func APIServicesCheck() Check {
+	return &readinessCheck{
+		name: APIServicesCheckName,
+		wait: func(ctx context.Context, env *CheckEnv) (ReadinessStatus, error) {
+			client, err := dynamic.NewForConfig(env.KubeAccess.RESTConfig)
+			if err != nil {
+				return ReadinessStatus{}, err
+			}
+			status, err := WaitForResourcesReady(ctx, env.Logger, client, nil, ReadinessFilter{},
+				apiServicesResource)
+			if err != nil {
+				return status, err
+			}
+
+			err = waitUntil(ctx, env.Logger, env.Options.newBackoff(), "API discovery", "complete",
+				func() (bool, error) {
+					failures, err := DiscoveryFailures(env.KubeAccess.Clientset.Discovery())
+					if err != nil {
+						return false, err
+					}
+					if len(failures) > 0 {
+						groups := make([]string, 0, len(failures))
+						for gv, err := range failures {
+							groups = append(groups, fmt.Sprintf("%s (%v)", gv, err))
+						}
+						sort.Strings(groups)
+						return false, fmt.Errorf("discovery failed for %s", strings.Join(groups, ", "))
+					}
+					return true, nil
+				})
+			return status, err
+		},
+	}
+}
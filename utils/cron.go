@@ -0,0 +1,169 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed standard cron schedule, as used by CronJobs: the
+// minute, hour, day of month, month and day of week fields, as bit sets.
+type cronSchedule struct {
+	minute, hour, dayOfMonth, month, dayOfWeek uint64
+	// The day of month and day of week fields are unrestricted. When both
+	// are restricted, a day matches either of them.
+	dayOfMonthStar, dayOfWeekStar bool
+}
+
+// cronField is the range and names of the values of a cron field.
+type cronField struct {
+	name     string
+	min, max uint
+	names    map[string]uint
+}
+
+var cronFields = [5]cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}},
+	{name: "day of week", min: 0, max: 6, names: map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}},
+}
+
+// cronDescriptors are the predefined schedules that may replace the fields.
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// parseCronSchedule parses a standard cron schedule of five fields, or one of
+// the predefined @ descriptors.
+func parseCronSchedule(spec string) (cronSchedule, error) {
+	var s cronSchedule
+	if fields, ok := cronDescriptors[strings.ToLower(strings.TrimSpace(spec))]; ok {
+		spec = fields
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return s, fmt.Errorf("expected %d fields, found %d: %q", len(cronFields), len(fields), spec)
+	}
+
+	bits := [5]*uint64{&s.minute, &s.hour, &s.dayOfMonth, &s.month, &s.dayOfWeek}
+	var stars [5]bool
+	for i, field := range fields {
+		var err error
+		if *bits[i], stars[i], err = cronFields[i].parse(field); err != nil {
+			return s, err
+		}
+	}
+	s.dayOfMonthStar, s.dayOfWeekStar = stars[2], stars[4]
+	return s, nil
+}
+
+// parse parses a comma-separated list of values, ranges and steps of the
+// field, and reports whether it is unrestricted.
+func (f cronField) parse(field string) (uint64, bool, error) {
+	var bits uint64
+	star := true
+	for _, expr := range strings.Split(field, ",") {
+		rangeAndStep := strings.SplitN(expr, "/", 2)
+		lowAndHigh := strings.SplitN(rangeAndStep[0], "-", 2)
+
+		var low, high uint
+		var err error
+		if lowAndHigh[0] == "*" || lowAndHigh[0] == "?" {
+			if len(lowAndHigh) > 1 {
+				return 0, false, fmt.Errorf("invalid %s %q", f.name, expr)
+			}
+			low, high = f.min, f.max
+		} else {
+			star = false
+			if low, err = f.value(lowAndHigh[0]); err != nil {
+				return 0, false, err
+			}
+			high = low
+			if len(lowAndHigh) > 1 {
+				if high, err = f.value(lowAndHigh[1]); err != nil {
+					return 0, false, err
+				}
+			}
+		}
+
+		step := uint64(1)
+		if len(rangeAndStep) > 1 {
+			if step, err = strconv.ParseUint(rangeAndStep[1], 10, 32); err != nil || step == 0 {
+				return 0, false, fmt.Errorf("invalid %s step %q", f.name, expr)
+			}
+			// A single value with a step, e.g. 5/15, runs up to the
+			// maximum.
+			if len(lowAndHigh) == 1 {
+				high = f.max
+			}
+			if step > 1 {
+				star = false
+			}
+		}
+		if low > high {
+			return 0, false, fmt.Errorf("invalid %s range %q", f.name, expr)
+		}
+		for v := low; v <= high; v += uint(step) {
+			bits |= 1 << v
+		}
+	}
+	return bits, star, nil
+}
+
+// value parses a single value of the field, by number or by name.
+func (f cronField) value(s string) (uint, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.ParseUint(s, 10, 32)
+	if err != nil || uint(v) < f.min || uint(v) > f.max {
+		return 0, fmt.Errorf("invalid %s %q: must be between %d and %d", f.name, s, f.min, f.max)
+	}
+	return uint(v), nil
+}
+
+// next returns the first time after t that the schedule fires, or the zero
+// time if it does not fire within five years, e.g. on February 30th.
+func (s cronSchedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for limit := t.AddDate(5, 0, 0); t.Before(limit); {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches reports whether the day of t matches the day of month and day of
+// week fields.
+func (s cronSchedule) dayMatches(t time.Time) bool {
+	dayOfMonth := s.dayOfMonth&(1<<uint(t.Day())) != 0
+	dayOfWeek := s.dayOfWeek&(1<<uint(t.Weekday())) != 0
+	if s.dayOfMonthStar || s.dayOfWeekStar {
+		return dayOfMonth && dayOfWeek
+	}
+	return dayOfMonth || dayOfWeek
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCronScheduleNext(t *testing.T) {
+	from := time.Date(2020, time.May, 1, 10, 7, 30, 0, time.UTC) // a Friday
+	for _, tc := range []struct {
+		spec     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2020, time.May, 1, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2020, time.May, 1, 10, 15, 0, 0, time.UTC)},
+		{"5/20 9-17 * * *", time.Date(2020, time.May, 1, 10, 25, 0, 0, time.UTC)},
+		{"0 0 * * mon-wed", time.Date(2020, time.May, 4, 0, 0, 0, 0, time.UTC)},
+		{"30 2 1,15 * *", time.Date(2020, time.May, 15, 2, 30, 0, 0, time.UTC)},
+		// Restricted days of month and of week match either.
+		{"0 0 13 * 0", time.Date(2020, time.May, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 12 * JUN ?", time.Date(2020, time.June, 1, 12, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2020, time.May, 1, 11, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	} {
+		schedule, err := parseCronSchedule(tc.spec)
+		require.NoError(t, err, tc.spec)
+		assert.Equal(t, tc.expected, schedule.next(from), tc.spec)
+	}
+
+	for _, spec := range []string{"* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *"} {
+		_, err := parseCronSchedule(spec)
+		assert.Error(t, err, spec)
+	}
+}
@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// daemonSetTolerations are the tolerations the DaemonSet controller adds to
+// every DaemonSet Pod, so that they are scheduled onto Nodes that are not
+// ready, under pressure, or cordoned.
+var daemonSetTolerations = []corev1.Toleration{
+	{Key: "node.kubernetes.io/not-ready", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute},
+	{Key: "node.kubernetes.io/unreachable", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute},
+	{Key: "node.kubernetes.io/disk-pressure", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+	{Key: "node.kubernetes.io/memory-pressure", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+	{Key: "node.kubernetes.io/pid-pressure", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+	{Key: "node.kubernetes.io/unschedulable", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+}
+
+// hostNetworkTolerations are additionally added to DaemonSet Pods that use
+// the host network.
+var hostNetworkTolerations = []corev1.Toleration{
+	{Key: "node.kubernetes.io/network-unavailable", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoSchedule},
+}
+
+// DaemonSetEligibleNodes returns the number of nodes the DaemonSet should run
+// a Pod on, based on the node name, node selector, required node affinity and
+// tolerations of its Pod template.
+func DaemonSetEligibleNodes(daemonSet *appsv1.DaemonSet, nodes []*corev1.Node) int {
+	var eligible int
+	for _, node := range nodes {
+		if daemonSetSchedulesOnto(&daemonSet.Spec.Template.Spec, node) {
+			eligible++
+		}
+	}
+	return eligible
+}
+
+// DaemonSetNodeReadiness cross-checks the number of Pods the DaemonSet
+// desires against the number of nodes that are eligible to run one.
+func DaemonSetNodeReadiness(daemonSet *appsv1.DaemonSet, nodes []*corev1.Node) (bool, string) {
+	desired := int(daemonSet.Status.DesiredNumberScheduled)
+	if eligible := DaemonSetEligibleNodes(daemonSet, nodes); desired != eligible {
+		return false, fmt.Sprintf("%d Pods desired, but %d Nodes are eligible", desired, eligible)
+	}
+	return true, ""
+}
+
+// daemonSetSchedulesOnto reports whether a DaemonSet Pod with the given spec
+// would be scheduled onto node.
+func daemonSetSchedulesOnto(spec *corev1.PodSpec, node *corev1.Node) bool {
+	if spec.NodeName != "" && spec.NodeName != node.Name {
+		return false
+	}
+	if !labels.SelectorFromSet(spec.NodeSelector).Matches(labels.Set(node.Labels)) {
+		return false
+	}
+	if affinity := spec.Affinity; affinity != nil && affinity.NodeAffinity != nil {
+		if required := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution; required != nil &&
+			!nodeSelectorMatches(required, node) {
+			return false
+		}
+	}
+
+	tolerations := append(append([]corev1.Toleration(nil), spec.Tolerations...), daemonSetTolerations...)
+	if spec.HostNetwork {
+		tolerations = append(tolerations, hostNetworkTolerations...)
+	}
+	for i := range node.Spec.Taints {
+		taint := &node.Spec.Taints[i]
+		if taint.Effect == corev1.TaintEffectPreferNoSchedule {
+			continue
+		}
+		if !toleratesTaint(tolerations, taint) {
+			return false
+		}
+	}
+	return true
+}
+
+// toleratesTaint reports whether any of the tolerations tolerates taint.
+func toleratesTaint(tolerations []corev1.Toleration, taint *corev1.Taint) bool {
+	for i := range tolerations {
+		if tolerations[i].ToleratesTaint(taint) {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeSelectorMatches reports whether node matches any of the terms of a
+// required node affinity.
+func nodeSelectorMatches(nodeSelector *corev1.NodeSelector, node *corev1.Node) bool {
+	for _, term := range nodeSelector.NodeSelectorTerms {
+		if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+			continue
+		}
+		if requirementsMatch(term.MatchExpressions, labels.Set(node.Labels)) &&
+			requirementsMatch(term.MatchFields, labels.Set{"metadata.name": node.Name}) {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeSelectorOperators maps node selector operators to label selector
+// operators.
+var nodeSelectorOperators = map[corev1.NodeSelectorOperator]selection.Operator{
+	corev1.NodeSelectorOpIn:           selection.In,
+	corev1.NodeSelectorOpNotIn:        selection.NotIn,
+	corev1.NodeSelectorOpExists:       selection.Exists,
+	corev1.NodeSelectorOpDoesNotExist: selection.DoesNotExist,
+	corev1.NodeSelectorOpGt:           selection.GreaterThan,
+	corev1.NodeSelectorOpLt:           selection.LessThan,
+}
+
+// requirementsMatch reports whether set matches all of the requirements.
+// Invalid requirements do not match.
+func requirementsMatch(requirements []corev1.NodeSelectorRequirement, set labels.Set) bool {
+	for _, r := range requirements {
+		op, ok := nodeSelectorOperators[r.Operator]
+		if !ok {
+			return false
+		}
+		requirement, err := labels.NewRequirement(r.Key, op, r.Values)
+		if err != nil || !requirement.Matches(set) {
+			return false
+		}
+	}
+	return true
+}
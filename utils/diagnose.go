@@ -0,0 +1,251 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+)
+
+// PodFailureReason classifies why a Pod is not ready.
+type PodFailureReason string
+
+const (
+	// PodImagePullFailure is a container whose image cannot be pulled, e.g.
+	// ImagePullBackOff or ErrImagePull.
+	PodImagePullFailure PodFailureReason = "ImagePullBackOff"
+	// PodCrashLoop is a container that keeps exiting.
+	PodCrashLoop PodFailureReason = "CrashLoopBackOff"
+	// PodContainerConfigError is a container that cannot be created, e.g. due
+	// to a missing ConfigMap or Secret.
+	PodContainerConfigError PodFailureReason = "ContainerConfigError"
+	// PodUnschedulable is a Pod the scheduler cannot place on any Node, e.g.
+	// due to insufficient cpu, taints, or there being no Nodes.
+	PodUnschedulable PodFailureReason = "Unschedulable"
+	// PodVolumePending is a Pod waiting on its volumes to be bound, attached
+	// or mounted.
+	PodVolumePending PodFailureReason = "VolumePending"
+	// PodInitContainerStuck is a Pod whose init containers have not
+	// completed.
+	PodInitContainerStuck PodFailureReason = "InitContainerStuck"
+	// PodNotReady is a Pod whose containers are running, but not ready, e.g.
+	// due to a failing readiness probe.
+	PodNotReady PodFailureReason = "NotReady"
+	// PodFailed is a Pod that has terminated unsuccessfully.
+	PodFailed PodFailureReason = "Failed"
+	// PodPending is a Pod that is pending for any other reason.
+	PodPending PodFailureReason = "Pending"
+)
+
+// PodDiagnosis is the classified reason a Pod is not ready.
+type PodDiagnosis struct {
+	Reason PodFailureReason
+	// Container is the name of the container at fault, if any.
+	Container string
+	// Message details the failure, e.g. the message of the scheduler.
+	Message string
+}
+
+// String formats the diagnosis as "Reason: container NAME: Message".
+func (d PodDiagnosis) String() string {
+	s := string(d.Reason)
+	if d.Container != "" {
+		s += fmt.Sprintf(": container %s", d.Container)
+	}
+	if d.Message != "" {
+		s += ": " + d.Message
+	}
+	return s
+}
+
+// volumeSchedulingMessages are the scheduler messages of Pods waiting on
+// volume binding.
+var volumeSchedulingMessages = []string{
+	"unbound immediate PersistentVolumeClaims",
+	"volume node affinity conflict",
+	"persistentvolumeclaim",
+}
+
+// DiagnosePod classifies why a Pod is not ready from its container statuses,
+// its conditions and, if given, its events.
+func DiagnosePod(pod *corev1.Pod, events []corev1.Event) PodDiagnosis {
+	if pod.Status.Phase == corev1.PodFailed {
+		return PodDiagnosis{Reason: PodFailed, Message: joinNonEmpty(": ", pod.Status.Reason, pod.Status.Message)}
+	}
+
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionFalse {
+			message := condition.Message
+			if message == "" {
+				message = latestEventMessage(events, "FailedScheduling")
+			}
+			if containsAny(message, volumeSchedulingMessages) {
+				return PodDiagnosis{Reason: PodVolumePending, Message: message}
+			}
+			return PodDiagnosis{Reason: PodUnschedulable, Message: message}
+		}
+	}
+
+	for _, status := range pod.Status.InitContainerStatuses {
+		if t := status.State.Terminated; t != nil && t.ExitCode == 0 {
+			continue
+		}
+		if d, ok := diagnoseContainer("init:"+status.Name, status); ok {
+			return d
+		}
+		return PodDiagnosis{
+			Reason:    PodInitContainerStuck,
+			Container: "init:" + status.Name,
+			Message:   containerStateMessage(status.State),
+		}
+	}
+
+	for _, status := range pod.Status.ContainerStatuses {
+		if d, ok := diagnoseContainer(status.Name, status); ok {
+			return d
+		}
+	}
+
+	if message := latestEventMessage(events, "FailedMount", "FailedAttachVolume"); message != "" {
+		return PodDiagnosis{Reason: PodVolumePending, Message: message}
+	}
+
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Running != nil && !status.Ready {
+			return PodDiagnosis{
+				Reason:    PodNotReady,
+				Container: status.Name,
+				Message:   latestEventMessage(events, "Unhealthy"),
+			}
+		}
+	}
+
+	message := latestEventMessage(events)
+	if message == "" {
+		message = joinNonEmpty(": ", pod.Status.Reason, pod.Status.Message)
+	}
+	if pod.Status.Phase == corev1.PodRunning {
+		return PodDiagnosis{Reason: PodNotReady, Message: message}
+	}
+	return PodDiagnosis{Reason: PodPending, Message: message}
+}
+
+// diagnoseContainer classifies a container that is waiting to run.
+func diagnoseContainer(name string, status corev1.ContainerStatus) (PodDiagnosis, bool) {
+	waiting := status.State.Waiting
+	if waiting == nil {
+		return PodDiagnosis{}, false
+	}
+	switch waiting.Reason {
+	case "ImagePullBackOff", "ErrImagePull", "InvalidImageName", "ErrImageNeverPull", "RegistryUnavailable":
+		return PodDiagnosis{
+			Reason:    PodImagePullFailure,
+			Container: name,
+			Message:   joinNonEmpty(": ", fmt.Sprintf("image %s", status.Image), waiting.Message),
+		}, true
+	case "CrashLoopBackOff":
+		message := fmt.Sprintf("restarted %d times", status.RestartCount)
+		if t := status.LastTerminationState.Terminated; t != nil {
+			message += fmt.Sprintf(", last exit code %d", t.ExitCode)
+			if t.Reason != "" {
+				message += fmt.Sprintf(" (%s)", t.Reason)
+			}
+		}
+		return PodDiagnosis{Reason: PodCrashLoop, Container: name, Message: message}, true
+	case "CreateContainerConfigError", "CreateContainerError":
+		return PodDiagnosis{Reason: PodContainerConfigError, Container: name, Message: waiting.Message}, true
+	}
+	return PodDiagnosis{}, false
+}
+
+// containerStateMessage describes the state of a container.
+func containerStateMessage(state corev1.ContainerState) string {
+	switch {
+	case state.Waiting != nil:
+		return joinNonEmpty(": ", "waiting", state.Waiting.Reason, state.Waiting.Message)
+	case state.Running != nil:
+		return fmt.Sprintf("running since %s", state.Running.StartedAt.UTC().Format("15:04:05"))
+	case state.Terminated != nil:
+		return fmt.Sprintf("exited with code %d", state.Terminated.ExitCode)
+	}
+	return "not started"
+}
+
+// latestEventMessage returns the message of the most recent event with one of
+// the given reasons, or of any Warning event if no reasons are given.
+func latestEventMessage(events []corev1.Event, reasons ...string) string {
+	sorted := append([]corev1.Event(nil), events...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return eventTime(sorted[j]).Before(eventTime(sorted[i]))
+	})
+	for _, event := range sorted {
+		if len(reasons) == 0 {
+			if event.Type == corev1.EventTypeWarning {
+				return event.Message
+			}
+			continue
+		}
+		for _, reason := range reasons {
+			if event.Reason == reason {
+				return event.Message
+			}
+		}
+	}
+	return ""
+}
+
+// eventTime returns the time an event last occurred.
+func eventTime(event corev1.Event) time.Time {
+	if !event.LastTimestamp.IsZero() {
+		return event.LastTimestamp.Time
+	}
+	if !event.EventTime.IsZero() {
+		return event.EventTime.Time
+	}
+	return event.FirstTimestamp.Time
+}
+
+// PodEvents lists the events of a Pod.
+func PodEvents(clientset kubernetes.Interface, pod *corev1.Pod) ([]corev1.Event, error) {
+	selector := fields.Set{
+		"involvedObject.kind": "Pod",
+		"involvedObject.name": pod.Name,
+	}.AsSelector().String()
+	events, err := clientset.CoreV1().Events(pod.Namespace).List(metav1.ListOptions{FieldSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+
+	// Guard against API Servers that do not support the field selector.
+	var podEvents []corev1.Event
+	for _, event := range events.Items {
+		if event.InvolvedObject.Kind == "Pod" && event.InvolvedObject.Name == pod.Name {
+			podEvents = append(podEvents, event)
+		}
+	}
+	return podEvents, nil
+}
+
+func containsAny(s string, substrs []string) bool {
+	for _, substr := range substrs {
+		if strings.Contains(s, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func joinNonEmpty(sep string, parts ...string) string {
+	var nonEmpty []string
+	for _, part := range parts {
+		if part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
+	}
+	return strings.Join(nonEmpty, sep)
+}
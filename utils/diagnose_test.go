@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// testPod decodes a Pod from the JSON of `kubectl get pod -o json`.
+func testPod(t *testing.T, data string) *corev1.Pod {
+	pod := &corev1.Pod{}
+	require.NoError(t, json.Unmarshal([]byte(data), pod))
+	return pod
+}
+
+// testEvent returns a Pod event that last occurred at the given minute.
+func testEvent(eventType, reason, message string, minute int) corev1.Event {
+	return corev1.Event{
+		InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: "web"},
+		Type:           eventType,
+		Reason:         reason,
+		Message:        message,
+		LastTimestamp:  metav1.NewTime(time.Date(2020, 4, 1, 12, minute, 0, 0, time.UTC)),
+	}
+}
+
+func TestDiagnosePod(t *testing.T) {
+	for name, tc := range map[string]struct {
+		status   string
+		events   []corev1.Event
+		expected PodDiagnosis
+	}{
+		"ImagePullBackOff": {
+			status: `{"phase": "Pending", "containerStatuses": [{"name": "web", "image": "nginx:1.17.99", "ready": false,
+				"state": {"waiting": {"reason": "ImagePullBackOff",
+					"message": "Back-off pulling image \"nginx:1.17.99\""}}}]}`,
+			expected: PodDiagnosis{Reason: PodImagePullFailure, Container: "web",
+				Message: `image nginx:1.17.99: Back-off pulling image "nginx:1.17.99"`},
+		},
+		"ErrImagePull without a message": {
+			status: `{"phase": "Pending", "containerStatuses": [{"name": "web", "image": "nginx:1.17.99",
+				"state": {"waiting": {"reason": "ErrImagePull"}}}]}`,
+			expected: PodDiagnosis{Reason: PodImagePullFailure, Container: "web", Message: "image nginx:1.17.99"},
+		},
+		"CrashLoopBackOff": {
+			status: `{"phase": "Running", "containerStatuses": [
+				{"name": "sidecar", "ready": true, "state": {"running": {"startedAt": "2020-04-01T12:00:00Z"}}},
+				{"name": "web", "ready": false, "restartCount": 5,
+					"state": {"waiting": {"reason": "CrashLoopBackOff",
+						"message": "back-off 2m40s restarting failed container=web"}},
+					"lastState": {"terminated": {"exitCode": 137, "reason": "OOMKilled"}}}]}`,
+			expected: PodDiagnosis{Reason: PodCrashLoop, Container: "web",
+				Message: "restarted 5 times, last exit code 137 (OOMKilled)"},
+		},
+		"CrashLoopBackOff with an exit code only": {
+			status: `{"phase": "Running", "containerStatuses": [{"name": "web", "restartCount": 1,
+				"state": {"waiting": {"reason": "CrashLoopBackOff"}},
+				"lastState": {"terminated": {"exitCode": 1}}}]}`,
+			expected: PodDiagnosis{Reason: PodCrashLoop, Container: "web", Message: "restarted 1 times, last exit code 1"},
+		},
+		"CreateContainerConfigError": {
+			status: `{"phase": "Pending", "containerStatuses": [{"name": "web",
+				"state": {"waiting": {"reason": "CreateContainerConfigError",
+					"message": "configmap \"web-config\" not found"}}}]}`,
+			expected: PodDiagnosis{Reason: PodContainerConfigError, Container: "web",
+				Message: `configmap "web-config" not found`},
+		},
+		"Unschedulable": {
+			status: `{"phase": "Pending", "conditions": [{"type": "PodScheduled", "status": "False",
+				"reason": "Unschedulable",
+				"message": "0/2 nodes are available: 2 Insufficient cpu."}]}`,
+			expected: PodDiagnosis{Reason: PodUnschedulable, Message: "0/2 nodes are available: 2 Insufficient cpu."},
+		},
+		"Unschedulable with the message of an event": {
+			status: `{"phase": "Pending", "conditions": [{"type": "PodScheduled", "status": "False",
+				"reason": "Unschedulable"}]}`,
+			events: []corev1.Event{
+				testEvent(corev1.EventTypeWarning, "FailedScheduling", "no nodes available to schedule pods", 1),
+				testEvent(corev1.EventTypeWarning, "FailedScheduling",
+					"0/1 nodes are available: 1 node(s) had taints that the pod didn't tolerate.", 2),
+			},
+			expected: PodDiagnosis{Reason: PodUnschedulable,
+				Message: "0/1 nodes are available: 1 node(s) had taints that the pod didn't tolerate."},
+		},
+		"unbound PersistentVolumeClaim": {
+			status: `{"phase": "Pending", "conditions": [{"type": "PodScheduled", "status": "False",
+				"reason": "Unschedulable",
+				"message": "pod has unbound immediate PersistentVolumeClaims (repeated 2 times)"}]}`,
+			expected: PodDiagnosis{Reason: PodVolumePending,
+				Message: "pod has unbound immediate PersistentVolumeClaims (repeated 2 times)"},
+		},
+		"volume not mounted": {
+			status: `{"phase": "Pending", "conditions": [{"type": "PodScheduled", "status": "True"}],
+				"containerStatuses": [{"name": "web", "state": {"waiting": {"reason": "ContainerCreating"}}}]}`,
+			events: []corev1.Event{
+				testEvent(corev1.EventTypeNormal, "Scheduled", "Successfully assigned default/web to ip-10-0-1-23", 1),
+				testEvent(corev1.EventTypeWarning, "FailedAttachVolume",
+					"AttachVolume.Attach failed for volume \"pvc-1\"", 2),
+				testEvent(corev1.EventTypeWarning, "FailedMount",
+					"Unable to attach or mount volumes: unmounted volumes=[data]", 3),
+			},
+			expected: PodDiagnosis{Reason: PodVolumePending,
+				Message: "Unable to attach or mount volumes: unmounted volumes=[data]"},
+		},
+		"stuck init container": {
+			status: `{"phase": "Pending", "conditions": [{"type": "PodScheduled", "status": "True"}],
+				"initContainerStatuses": [
+					{"name": "migrate", "state": {"terminated": {"exitCode": 0, "reason": "Completed"}}},
+					{"name": "wait-for-db", "state": {"running": {"startedAt": "2020-04-01T12:03:04Z"}}}],
+				"containerStatuses": [{"name": "web", "state": {"waiting": {"reason": "PodInitializing"}}}]}`,
+			expected: PodDiagnosis{Reason: PodInitContainerStuck, Container: "init:wait-for-db",
+				Message: "running since 12:03:04"},
+		},
+		"failed init container": {
+			status: `{"phase": "Pending", "initContainerStatuses": [{"name": "migrate", "restartCount": 3,
+				"state": {"waiting": {"reason": "CrashLoopBackOff"}},
+				"lastState": {"terminated": {"exitCode": 2, "reason": "Error"}}}]}`,
+			expected: PodDiagnosis{Reason: PodCrashLoop, Container: "init:migrate",
+				Message: "restarted 3 times, last exit code 2 (Error)"},
+		},
+		"failing readiness probe": {
+			status: `{"phase": "Running", "containerStatuses": [{"name": "web", "ready": false,
+				"state": {"running": {"startedAt": "2020-04-01T12:00:00Z"}}}]}`,
+			events: []corev1.Event{
+				testEvent(corev1.EventTypeWarning, "Unhealthy", "Readiness probe failed: HTTP probe failed with statuscode: 503", 4),
+			},
+			expected: PodDiagnosis{Reason: PodNotReady, Container: "web",
+				Message: "Readiness probe failed: HTTP probe failed with statuscode: 503"},
+		},
+		"evicted": {
+			status: `{"phase": "Failed", "reason": "Evicted",
+				"message": "The node was low on resource: memory."}`,
+			expected: PodDiagnosis{Reason: PodFailed, Message: "Evicted: The node was low on resource: memory."},
+		},
+		"pending": {
+			status: `{"phase": "Pending"}`,
+			events: []corev1.Event{
+				testEvent(corev1.EventTypeWarning, "FailedCreatePodSandBox", "failed to set up sandbox container network", 1),
+				testEvent(corev1.EventTypeNormal, "SandboxChanged", "Pod sandbox changed, it will be killed and re-created.", 2),
+			},
+			expected: PodDiagnosis{Reason: PodPending, Message: "failed to set up sandbox container network"},
+		},
+	} {
+		pod := testPod(t, `{"apiVersion": "v1", "kind": "Pod",
+			"metadata": {"namespace": "default", "name": "web"}, "status": `+tc.status+`}`)
+		assert.Equal(t, tc.expected, DiagnosePod(pod, tc.events), name)
+	}
+}
+
+func TestPodDiagnosisString(t *testing.T) {
+	assert.Equal(t, "CrashLoopBackOff: container web: restarted 5 times",
+		PodDiagnosis{Reason: PodCrashLoop, Container: "web", Message: "restarted 5 times"}.String())
+	assert.Equal(t, "Unschedulable: 0/2 nodes are available",
+		PodDiagnosis{Reason: PodUnschedulable, Message: "0/2 nodes are available"}.String())
+	assert.Equal(t, "Pending", PodDiagnosis{Reason: PodPending}.String())
+}
@@ -0,0 +1,266 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/restmapper"
+)
+
+// ReadinessRule evaluates the readiness of an object, returning the reason it
+// is not ready.
+type ReadinessRule func(obj *unstructured.Unstructured) (bool, string)
+
+// ReadinessRules maps GroupVersionKinds to the ReadinessRule that evaluates
+// their objects. Objects of kinds without a rule are evaluated with
+// GenericReadiness.
+type ReadinessRules struct {
+	mu    sync.RWMutex
+	rules map[schema.GroupVersionKind]ReadinessRule
+}
+
+// NewReadinessRules creates an empty set of ReadinessRules.
+func NewReadinessRules() *ReadinessRules {
+	return &ReadinessRules{rules: make(map[schema.GroupVersionKind]ReadinessRule)}
+}
+
+// DefaultReadinessRules creates ReadinessRules that evaluate the built-in
+// kinds with the same semantics as the typed readiness evaluators, e.g.
+// DeploymentReadiness.
+func DefaultReadinessRules() *ReadinessRules {
+	r := NewReadinessRules()
+	r.Register(corev1.SchemeGroupVersion.WithKind("Node"), typedRule(func() interface{} { return &corev1.Node{} }))
+	r.Register(corev1.SchemeGroupVersion.WithKind("Pod"), typedRule(func() interface{} { return &corev1.Pod{} }))
+	r.Register(appsv1.SchemeGroupVersion.WithKind("Deployment"),
+		typedRule(func() interface{} { return &appsv1.Deployment{} }))
+	r.Register(appsv1.SchemeGroupVersion.WithKind("ReplicaSet"),
+		typedRule(func() interface{} { return &appsv1.ReplicaSet{} }))
+	r.Register(appsv1.SchemeGroupVersion.WithKind("DaemonSet"),
+		typedRule(func() interface{} { return &appsv1.DaemonSet{} }))
+	r.Register(appsv1.SchemeGroupVersion.WithKind("StatefulSet"),
+		typedRule(func() interface{} { return &appsv1.StatefulSet{} }))
+	r.Register(batchv1.SchemeGroupVersion.WithKind("Job"), typedRule(func() interface{} { return &batchv1.Job{} }))
+	r.Register(batchv1beta1.SchemeGroupVersion.WithKind("CronJob"),
+		typedRule(func() interface{} { return &batchv1beta1.CronJob{} }))
+	return r
+}
+
+// typedRule evaluates an object by converting it to the typed object returned
+// by newObj, and evaluating it with objectReadiness.
+func typedRule(newObj func() interface{}) ReadinessRule {
+	return func(obj *unstructured.Unstructured) (bool, string) {
+		typed := newObj()
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, typed); err != nil {
+			return false, fmt.Sprintf("invalid %s: %v", obj.GetKind(), err)
+		}
+		o, _ := objectReadiness(typed)
+		return o.Ready, o.Reason
+	}
+}
+
+// Register sets the rule of a GroupVersionKind, replacing any existing rule.
+func (r *ReadinessRules) Register(gvk schema.GroupVersionKind, rule ReadinessRule) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rules[gvk] = rule
+}
+
+// Evaluate evaluates the readiness of obj with the rule of its
+// GroupVersionKind, or with GenericReadiness if it has none.
+func (r *ReadinessRules) Evaluate(obj *unstructured.Unstructured) ObjectStatus {
+	o := ObjectStatus{Kind: obj.GetKind(), Namespace: obj.GetNamespace(), Name: obj.GetName()}
+
+	rule := GenericReadiness
+	if r != nil {
+		r.mu.RLock()
+		if custom, ok := r.rules[obj.GroupVersionKind()]; ok {
+			rule = custom
+		}
+		r.mu.RUnlock()
+	}
+	o.Ready, o.Reason = rule(obj)
+	return o
+}
+
+// GenericReadiness evaluates the readiness of an object of any kind from the
+// common conventions of its status:
+//
+//   - status.observedGeneration must have caught up to metadata.generation,
+//   - a Ready, or otherwise Available, status condition must be True,
+//   - without either condition, status.readyReplicas must match
+//     spec.replicas.
+//
+// Objects that follow none of these conventions are ready once they exist.
+func GenericReadiness(obj *unstructured.Unstructured) (bool, string) {
+	generation, _ := nestedInt(obj.Object, "metadata", "generation")
+	if observed, ok := nestedInt(obj.Object, "status", "observedGeneration"); ok && observed < generation {
+		return false, "spec update has not been observed"
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, conditionType := range []string{"Ready", "Available"} {
+		for _, c := range conditions {
+			condition, ok := c.(map[string]interface{})
+			if !ok || condition["type"] != conditionType {
+				continue
+			}
+			status, _ := condition["status"].(string)
+			if status == string(corev1.ConditionTrue) {
+				return true, ""
+			}
+			message, _ := condition["message"].(string)
+			return false, fmt.Sprintf("condition %s is %s: %s", conditionType, status, message)
+		}
+	}
+
+	if replicas, ok := nestedInt(obj.Object, "spec", "replicas"); ok {
+		ready, _ := nestedInt(obj.Object, "status", "readyReplicas")
+		if ready < replicas {
+			return false, fmt.Sprintf("%d/%d replicas ready", ready, replicas)
+		}
+	}
+	return true, ""
+}
+
+// nestedInt returns the integer field of obj at the given path, whether it
+// was decoded as an int64 or a float64.
+func nestedInt(obj map[string]interface{}, fields ...string) (int64, bool) {
+	value, ok, err := unstructured.NestedFieldNoCopy(obj, fields...)
+	if !ok || err != nil {
+		return 0, false
+	}
+	switch v := value.(type) {
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case float64:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+// dynamicSource lists and watches all objects of a resource, across all
+// namespaces, through the dynamic client. The typed clientset passed to its
+// functions is unused.
+func dynamicSource(client dynamic.Interface, resource schema.GroupVersionResource) kindSource {
+	return kindSource{
+		list: func(_ kubernetes.Interface, opts metav1.ListOptions) ([]runtime.Object, string, error) {
+			l, err := client.Resource(resource).List(opts)
+			if err != nil {
+				return nil, "", err
+			}
+			objs := make([]runtime.Object, len(l.Items))
+			for i := range l.Items {
+				objs[i] = &l.Items[i]
+			}
+			return objs, l.GetResourceVersion(), nil
+		},
+		watch: func(_ kubernetes.Interface, opts metav1.ListOptions) (watch.Interface, error) {
+			return client.Resource(resource).Watch(opts)
+		},
+	}
+}
+
+// NewDynamicReadinessTracker creates a ReadinessTracker that follows all
+// objects of the given resources, across all namespaces, through the dynamic
+// client. Objects are evaluated with rules, which may be nil to evaluate all
+// objects with GenericReadiness.
+func NewDynamicReadinessTracker(client dynamic.Interface, rules *ReadinessRules,
+	resources ...schema.GroupVersionResource) (*ReadinessTracker, error) {
+	if len(resources) == 0 {
+		return nil, fmt.Errorf("no resources to track")
+	}
+
+	r := newReadinessTracker(nil)
+	r.rules = rules
+	for _, resource := range resources {
+		kind := resource.String()
+		if _, ok := r.sources[kind]; !ok {
+			r.sources[kind] = dynamicSource(client, resource)
+			r.kinds = append(r.kinds, kind)
+			r.reported[kind] = true
+		}
+	}
+	return r, nil
+}
+
+// ResolveResources resolves resource names, e.g. "deployments",
+// "deployments.apps" or "certificates.v1alpha2.cert-manager.io", to the
+// preferred version of each resource served by the API Server.
+func ResolveResources(client discovery.DiscoveryInterface, names ...string) ([]schema.GroupVersionResource, error) {
+	groupResources, err := restmapper.GetAPIGroupResources(client)
+	if err != nil {
+		return nil, err
+	}
+	mapper := restmapper.NewDiscoveryRESTMapper(groupResources)
+
+	resources := make([]schema.GroupVersionResource, len(names))
+	for i, name := range names {
+		gvr, gr := schema.ParseResourceArg(name)
+		partial := gr.WithVersion("")
+		if gvr != nil {
+			partial = *gvr
+		}
+		if resources[i], err = mapper.ResourceFor(partial); err != nil {
+			return nil, fmt.Errorf("resolving resource %q: %w", name, err)
+		}
+	}
+	return resources, nil
+}
+
+// WaitForResourcesReady waits for all objects of the given resources that
+// pass filter to be ready, as evaluated by rules. Unlike WaitForKindsReady,
+// there need not be any objects, so that add-ons without custom resources yet
+// are ready.
+func WaitForResourcesReady(ctx context.Context, logger Logger, client dynamic.Interface, rules *ReadinessRules,
+	filter ReadinessFilter, resources ...schema.GroupVersionResource) (ReadinessStatus, error) {
+	tracker, err := NewDynamicReadinessTracker(client, rules, resources...)
+	if err != nil {
+		return ReadinessStatus{}, err
+	}
+	tracker.Logger = logger
+	tracker.Filter = filter
+
+	status, err := tracker.WaitForReady(ctx, nil)
+	logReadiness(logger, status)
+	if err != nil {
+		return status, err
+	}
+	logger.Logf("%d out of %d objects are ready\n", len(status.Objects), len(status.Objects))
+	return status, nil
+}
+
+// ResourcesCheck ensures that all objects of the named resources, e.g. the
+// custom resources of an add-on, are ready, as evaluated by rules. Resource
+// names are resolved with ResolveResources when the check is run. Objects are
+// filtered by the Filter of the smoke test options.
+func ResourcesCheck(name string, rules *ReadinessRules, resources ...string) Check {
+	return &readinessCheck{
+		name: name,
+		wait: func(ctx context.Context, env *CheckEnv) (ReadinessStatus, error) {
+			gvrs, err := ResolveResources(env.KubeAccess.Clientset.Discovery(), resources...)
+			if err != nil {
+				return ReadinessStatus{}, err
+			}
+			client, err := dynamic.NewForConfig(env.KubeAccess.RESTConfig)
+			if err != nil {
+				return ReadinessStatus{}, err
+			}
+			return WaitForResourcesReady(ctx, env.Logger, client, rules, env.Options.Filter, gvrs...)
+		},
+	}
+}
@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// testUnstructured decodes an object from JSON, as the dynamic client does.
+func testUnstructured(t *testing.T, data string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	require.NoError(t, json.Unmarshal([]byte(data), &obj.Object))
+	return obj
+}
+
+func TestGenericReadiness(t *testing.T) {
+	for name, tc := range map[string]struct {
+		obj    string
+		ready  bool
+		reason string
+	}{
+		"Ready condition": {
+			obj: `{"kind": "Certificate", "metadata": {"generation": 2},
+				"status": {"observedGeneration": 2, "conditions": [{"type": "Ready", "status": "True"}]}}`,
+			ready: true,
+		},
+		"Ready condition is False": {
+			obj: `{"kind": "Certificate", "status": {"conditions": [
+				{"type": "Issuing", "status": "True"},
+				{"type": "Ready", "status": "False", "message": "Issuing certificate as Secret does not exist"}]}}`,
+			reason: "condition Ready is False: Issuing certificate as Secret does not exist",
+		},
+		"Ready condition is Unknown without a message": {
+			obj:    `{"kind": "Certificate", "status": {"conditions": [{"type": "Ready", "status": "Unknown"}]}}`,
+			reason: "condition Ready is Unknown: ",
+		},
+		"Available condition": {
+			obj:   `{"kind": "APIService", "status": {"conditions": [{"type": "Available", "status": "True"}]}}`,
+			ready: true,
+		},
+		"Ready takes precedence over Available": {
+			obj: `{"kind": "Widget", "status": {"conditions": [
+				{"type": "Available", "status": "True"},
+				{"type": "Ready", "status": "False", "message": "reconciling"}]}}`,
+			reason: "condition Ready is False: reconciling",
+		},
+		"spec update not observed": {
+			obj: `{"kind": "Widget", "metadata": {"generation": 3},
+				"status": {"observedGeneration": 2, "conditions": [{"type": "Ready", "status": "True"}]}}`,
+			reason: "spec update has not been observed",
+		},
+		"observedGeneration decoded as a float": {
+			obj: `{"kind": "Widget", "metadata": {"generation": 3},
+				"status": {"observedGeneration": 3.0, "conditions": [{"type": "Ready", "status": "True"}]}}`,
+			ready: true,
+		},
+		"replicas not ready": {
+			obj:    `{"kind": "Widget", "spec": {"replicas": 3}, "status": {"readyReplicas": 1}}`,
+			reason: "1/3 replicas ready",
+		},
+		"replicas ready": {
+			obj:   `{"kind": "Widget", "spec": {"replicas": 3}, "status": {"readyReplicas": 3}}`,
+			ready: true,
+		},
+		"replicas without a status": {
+			obj:    `{"kind": "Widget", "spec": {"replicas": 2}}`,
+			reason: "0/2 replicas ready",
+		},
+		"no status": {
+			obj:   `{"kind": "ConfigMap", "data": {"key": "value"}}`,
+			ready: true,
+		},
+		"unrelated conditions": {
+			obj:   `{"kind": "Widget", "status": {"conditions": [{"type": "Progressing", "status": "False"}]}}`,
+			ready: true,
+		},
+	} {
+		ready, reason := GenericReadiness(testUnstructured(t, tc.obj))
+		assert.Equal(t, tc.ready, ready, name)
+		assert.Equal(t, tc.reason, reason, name)
+	}
+}
+
+func TestDefaultReadinessRules(t *testing.T) {
+	rules := DefaultReadinessRules()
+	for name, tc := range map[string]struct {
+		obj      string
+		expected ObjectStatus
+	}{
+		// Built-in kinds are evaluated like their typed objects, i.e. a
+		// Deployment without an Available condition is not ready.
+		"Deployment": {
+			obj: `{"apiVersion": "apps/v1", "kind": "Deployment",
+				"metadata": {"namespace": "default", "name": "web"}, "status": {"readyReplicas": 1}}`,
+			expected: ObjectStatus{Kind: "Deployment", Namespace: "default", Name: "web",
+				Reason: "condition Available is not reported"},
+		},
+		"Pod": {
+			obj: `{"apiVersion": "v1", "kind": "Pod", "metadata": {"namespace": "default", "name": "web-1"},
+				"status": {"phase": "Running", "conditions": [{"type": "Ready", "status": "True"}]}}`,
+			expected: ObjectStatus{Kind: "Pod", Namespace: "default", Name: "web-1", Ready: true},
+		},
+		"invalid built-in kind": {
+			obj: `{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "web"},
+				"spec": {"replicas": "three"}}`,
+			expected: ObjectStatus{Kind: "Deployment", Name: "web"},
+		},
+		// Other versions of a built-in kind, and other kinds, are evaluated
+		// with GenericReadiness.
+		"other version of a built-in kind": {
+			obj: `{"apiVersion": "apps/v1beta1", "kind": "Deployment", "metadata": {"name": "web"},
+				"spec": {"replicas": 2}, "status": {"readyReplicas": 2}}`,
+			expected: ObjectStatus{Kind: "Deployment", Name: "web", Ready: true},
+		},
+		"custom resource": {
+			obj: `{"apiVersion": "cert-manager.io/v1alpha2", "kind": "Certificate",
+				"metadata": {"namespace": "default", "name": "tls"},
+				"status": {"conditions": [{"type": "Ready", "status": "False", "message": "pending"}]}}`,
+			expected: ObjectStatus{Kind: "Certificate", Namespace: "default", Name: "tls",
+				Reason: "condition Ready is False: pending"},
+		},
+	} {
+		o := rules.Evaluate(testUnstructured(t, tc.obj))
+		if name == "invalid built-in kind" {
+			assert.Contains(t, o.Reason, "invalid Deployment: ", name)
+			o.Reason = ""
+		}
+		assert.Equal(t, tc.expected, o, name)
+	}
+
+	// Registered rules replace the default rule of their kind.
+	certificate := schema.GroupVersionKind{Group: "cert-manager.io", Version: "v1alpha2", Kind: "Certificate"}
+	rules.Register(certificate, func(obj *unstructured.Unstructured) (bool, string) {
+		return obj.GetName() == "tls", "custom"
+	})
+	o := rules.Evaluate(testUnstructured(t, `{"apiVersion": "cert-manager.io/v1alpha2", "kind": "Certificate",
+		"metadata": {"name": "tls"}}`))
+	assert.Equal(t, ObjectStatus{Kind: "Certificate", Name: "tls", Ready: true, Reason: "custom"}, o)
+
+	// Without rules, all objects are evaluated with GenericReadiness.
+	var none *ReadinessRules
+	o = none.Evaluate(testUnstructured(t, `{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "web"}}`))
+	assert.Equal(t, ObjectStatus{Kind: "Deployment", Name: "web", Ready: true}, o)
+}
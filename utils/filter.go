@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"fmt"
+	"path"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// ReadinessFilter scopes the objects whose readiness is checked, e.g. so that
+// a broken Pod in an unrelated namespace does not fail the smoke test. The
+// zero value checks all objects.
+type ReadinessFilter struct {
+	// Namespaces limits namespaced objects to the given namespaces. Objects
+	// that are not namespaced, e.g. Nodes, are not filtered by namespace.
+	Namespaces []string
+
+	// LabelSelector limits objects to those matching the label selector, e.g.
+	// "app=nginx,tier!=batch".
+	LabelSelector string
+
+	// FieldSelectors maps kinds to the field selector that limits their
+	// objects, e.g. {"Pod": "status.phase!=Succeeded"}. The fields that can
+	// be selected differ by kind, so a selector only applies to its kind.
+	// Kinds are named as in NewReadinessTracker; resources followed through
+	// the dynamic client are not limited by field.
+	FieldSelectors map[string]string
+
+	// Exclude ignores objects matching any of the patterns. A pattern is
+	// either "namespace/name", "Kind/namespace/name" or, for objects that are
+	// not namespaced, "Kind/name". Each segment may use the wildcards of
+	// path.Match, e.g. "Pod/kube-system/aws-node-*".
+	Exclude []string
+
+	// TerminalPods decides how terminal Pods that their controller has
+	// replaced with a ready Pod, e.g. Pods evicted by a Node drain, are
+	// evaluated.
+	// It only applies to Pods. The zero value is TerminalPodsReport.
+	TerminalPods TerminalPodPolicy
+}
+
+// validate checks that the selectors, patterns and policy of the filter are
+// valid.
+func (f ReadinessFilter) validate() error {
+	if _, err := labels.Parse(f.LabelSelector); err != nil {
+		return fmt.Errorf("invalid label selector %q: %w", f.LabelSelector, err)
+	}
+	for kind, selector := range f.FieldSelectors {
+		if _, err := resolveKind(kind); err != nil {
+			return fmt.Errorf("invalid field selector of %q: %w", kind, err)
+		}
+		if _, err := fields.ParseSelector(selector); err != nil {
+			return fmt.Errorf("invalid field selector %q of %s: %w", selector, kind, err)
+		}
+	}
+	for _, pattern := range f.Exclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+		}
+	}
+	_, err := ParseTerminalPodPolicy(string(f.TerminalPods))
+	return err
+}
+
+// terminalPodPolicy returns the TerminalPods policy, defaulting the zero value.
+func (f ReadinessFilter) terminalPodPolicy() TerminalPodPolicy {
+	if f.TerminalPods == "" {
+		return TerminalPodsReport
+	}
+	return f.TerminalPods
+}
+
+// listOptions returns the options to list and watch objects of a kind with,
+// so that the API Server applies the selectors.
+func (f ReadinessFilter) listOptions(kind string) metav1.ListOptions {
+	opts := metav1.ListOptions{LabelSelector: f.LabelSelector}
+	for k, selector := range f.FieldSelectors {
+		if resolved, err := resolveKind(k); err == nil && resolved == kind {
+			opts.FieldSelector = selector
+		}
+	}
+	return opts
+}
+
+// includes reports whether the object is in one of the namespaces of the
+// filter, and is not excluded.
+func (f ReadinessFilter) includes(o ObjectStatus) bool {
+	if o.Namespace != "" && len(f.Namespaces) > 0 {
+		var found bool
+		for _, ns := range f.Namespaces {
+			if ns == o.Namespace {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	var names []string
+	if o.Namespace == "" {
+		names = []string{o.Kind + "/" + o.Name}
+	} else {
+		names = []string{o.Namespace + "/" + o.Name, o.Kind + "/" + o.Namespace + "/" + o.Name}
+	}
+	for _, pattern := range f.Exclude {
+		for _, name := range names {
+			if matched, _ := path.Match(pattern, name); matched {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReadinessFilterListOptions(t *testing.T) {
+	filter := ReadinessFilter{
+		LabelSelector:  "app=web",
+		FieldSelectors: map[string]string{"pods": "status.phase!=Succeeded"},
+	}
+	assert.NoError(t, filter.validate())
+
+	// Pod field selectors are not applied to other kinds, whose lists the API
+	// Server would reject.
+	assert.Equal(t, metav1.ListOptions{LabelSelector: "app=web", FieldSelector: "status.phase!=Succeeded"},
+		filter.listOptions("Pod"))
+	assert.Equal(t, metav1.ListOptions{LabelSelector: "app=web"}, filter.listOptions("DaemonSet"))
+
+	filter.FieldSelectors = map[string]string{"Widget": "metadata.name=foo"}
+	assert.EqualError(t, filter.validate(), `invalid field selector of "Widget": unsupported kind "Widget"`)
+}
@@ -0,0 +1,192 @@
+package utils
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SmokeTestJUnitEnvVar is the environment variable naming where to write the
+// JUnit XML report of each smoke test run. It is interpreted like
+// SmokeTestReportEnvVar.
+const SmokeTestJUnitEnvVar = "EKS_SMOKE_TEST_JUNIT"
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr,omitempty"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string           `xml:"name,attr"`
+	Tests      int              `xml:"tests,attr"`
+	Failures   int              `xml:"failures,attr"`
+	Errors     int              `xml:"errors,attr"`
+	Skipped    int              `xml:"skipped,attr"`
+	Time       string           `xml:"time,attr"`
+	Timestamp  string           `xml:"timestamp,attr,omitempty"`
+	Properties *junitProperties `xml:"properties,omitempty"`
+	TestCases  []junitTestCase  `xml:"testcase"`
+}
+
+type junitProperties struct {
+	Properties []junitProperty `xml:"property"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the report as JUnit XML. Each cluster is a testsuite, and
+// each of its checks a testcase. Failed checks include the objects that are
+// not ready.
+func (r *SmokeTestReport) WriteJUnit(w io.Writer) error {
+	suites := junitTestSuites{Name: r.Test}
+	classname := strings.TrimSuffix("eks-smoke."+r.Test, ".")
+
+	for _, cluster := range r.Clusters {
+		suite := junitTestSuite{
+			Name:      cluster.Name,
+			Timestamp: r.StartTime.UTC().Format(time.RFC3339),
+			Properties: &junitProperties{Properties: []junitProperty{
+				{Name: "serverVersion", Value: cluster.ServerVersion},
+				{Name: "serverGitVersion", Value: cluster.ServerGitVersion},
+				{Name: "desiredNodeCount", Value: fmt.Sprint(cluster.DesiredNodeCount)},
+			}},
+		}
+		for _, g := range cluster.NodeGroups {
+			suite.Properties.Properties = append(suite.Properties.Properties, junitProperty{
+				Name:  fmt.Sprintf("nodeGroup.%s.desiredCount", g.Name),
+				Value: fmt.Sprint(g.DesiredCount),
+			})
+		}
+		var elapsed time.Duration
+		if cluster.Error != "" {
+			suite.TestCases = append(suite.TestCases, junitTestCase{
+				Name:      "setup",
+				Classname: classname + "." + cluster.Name,
+				Time:      junitSeconds(0),
+				Error:     &junitMessage{Message: cluster.Error, Type: "error", Text: cluster.Error},
+			})
+			suite.Errors++
+		}
+		for _, check := range cluster.Checks {
+			tc := junitTestCase{
+				Name:      check.Name,
+				Classname: classname + "." + cluster.Name,
+				Time:      junitSeconds(check.Duration),
+			}
+			switch check.Status {
+			case CheckFailed:
+				tc.Failure = &junitMessage{Message: fmt.Sprint(check.Err), Type: "failure", Text: failureDetails(check)}
+				suite.Failures++
+			case CheckSkipped:
+				tc.Skipped = &junitMessage{Message: check.Message}
+				suite.Skipped++
+			}
+			elapsed += check.Duration
+			suite.TestCases = append(suite.TestCases, tc)
+		}
+		suite.Tests = len(suite.TestCases)
+		suite.Time = junitSeconds(elapsed)
+		suites.add(suite)
+	}
+
+	// Failures that are not attributed to a single cluster are reported in
+	// their own testsuite.
+	if len(r.Errors) > 0 {
+		suite := junitTestSuite{Name: "setup", Time: junitSeconds(0)}
+		for i, err := range r.Errors {
+			suite.TestCases = append(suite.TestCases, junitTestCase{
+				Name:      fmt.Sprintf("setup-%d", i),
+				Classname: classname,
+				Time:      junitSeconds(0),
+				Error:     &junitMessage{Message: err, Type: "error", Text: err},
+			})
+		}
+		suite.Tests = len(suite.TestCases)
+		suite.Errors = len(suite.TestCases)
+		suites.add(suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// WriteJUnitFile writes the report as JUnit XML to the file at path.
+func (r *SmokeTestReport) WriteJUnitFile(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := r.WriteJUnit(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (s *junitTestSuites) add(suite junitTestSuite) {
+	s.Suites = append(s.Suites, suite)
+	s.Tests += suite.Tests
+	s.Failures += suite.Failures
+	s.Errors += suite.Errors
+	s.Skipped += suite.Skipped
+}
+
+// failureDetails describes a failed check, and each object it found not
+// ready, one per line.
+func failureDetails(check CheckResult) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v\n", check.Err)
+	for _, o := range check.Objects {
+		if o.Ready {
+			continue
+		}
+		if o.Reason != "" {
+			fmt.Fprintf(&b, "%s: %s\n", o, o.Reason)
+		} else {
+			fmt.Fprintf(&b, "%s: not ready\n", o)
+		}
+	}
+	return b.String()
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
@@ -0,0 +1,141 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// KubeconfigAuthenticator is the exec credential plugin that a generated
+// kubeconfig authenticates with.
+type KubeconfigAuthenticator string
+
+const (
+	// AWSCLIAuthenticator authenticates with `aws eks get-token`, as the
+	// kubeconfigs of the nodejs Cluster do.
+	AWSCLIAuthenticator KubeconfigAuthenticator = "aws"
+	// IAMAuthenticator authenticates with `aws-iam-authenticator token`.
+	IAMAuthenticator KubeconfigAuthenticator = "aws-iam-authenticator"
+)
+
+// KubeconfigOptions represents the AWS credentials to scope a generated
+// kubeconfig with, like the KubeconfigOptions of the nodejs Cluster. The
+// options can be used independently, or additively.
+type KubeconfigOptions struct {
+	// RoleARN is the ARN of the role to assume instead of the default AWS
+	// credential provider chain. It is passed to the exec credential plugin
+	// as an arg.
+	RoleARN string
+	// ProfileName is the AWS credential profile to use instead of the default
+	// AWS credential provider chain. It is passed to the exec credential
+	// plugin as the AWS_PROFILE env.
+	ProfileName string
+	// Authenticator is the exec credential plugin. It defaults to
+	// AWSCLIAuthenticator.
+	Authenticator KubeconfigAuthenticator
+}
+
+// The kubeconfig types below mirror the object generated by the nodejs
+// Cluster, field for field and in the same order, so that it serializes to the
+// same JSON.
+
+type kubeconfigFile struct {
+	APIVersion     string              `json:"apiVersion"`
+	Clusters       []kubeconfigCluster `json:"clusters"`
+	Contexts       []kubeconfigContext `json:"contexts"`
+	CurrentContext string              `json:"current-context"`
+	Kind           string              `json:"kind"`
+	Users          []kubeconfigUser    `json:"users"`
+}
+
+type kubeconfigCluster struct {
+	Cluster struct {
+		Server                   string `json:"server"`
+		CertificateAuthorityData string `json:"certificate-authority-data"`
+	} `json:"cluster"`
+	Name string `json:"name"`
+}
+
+type kubeconfigContext struct {
+	Context struct {
+		Cluster string `json:"cluster"`
+		User    string `json:"user"`
+	} `json:"context"`
+	Name string `json:"name"`
+}
+
+type kubeconfigUser struct {
+	Name string `json:"name"`
+	User struct {
+		Exec kubeconfigExec `json:"exec"`
+	} `json:"user"`
+}
+
+type kubeconfigExec struct {
+	APIVersion string              `json:"apiVersion"`
+	Command    string              `json:"command"`
+	Args       []string            `json:"args"`
+	Env        []kubeconfigExecEnv `json:"env,omitempty"`
+}
+
+type kubeconfigExecEnv struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// GenerateKubeconfig generates the kubeconfig of an EKS cluster from its name,
+// endpoint and base64 encoded certificate authority data, scoped to opts. With
+// the AWSCLIAuthenticator, it is byte for byte the JSON kubeconfig of
+// Cluster.getKubeconfig in the nodejs package.
+func GenerateKubeconfig(clusterName, endpoint, certificateAuthorityData string,
+	opts KubeconfigOptions) ([]byte, error) {
+	exec := kubeconfigExec{
+		APIVersion: "client.authentication.k8s.io/v1alpha1",
+		Command:    string(opts.Authenticator),
+	}
+	switch opts.Authenticator {
+	case AWSCLIAuthenticator, "":
+		exec.Command = string(AWSCLIAuthenticator)
+		exec.Args = []string{"eks", "get-token", "--cluster-name", clusterName}
+		if opts.RoleARN != "" {
+			exec.Args = append(exec.Args, "--role", opts.RoleARN)
+		}
+	case IAMAuthenticator:
+		exec.Args = []string{"token", "-i", clusterName}
+		if opts.RoleARN != "" {
+			exec.Args = append(exec.Args, "-r", opts.RoleARN)
+		}
+	default:
+		return nil, fmt.Errorf("unknown kubeconfig authenticator %q: must be %s or %s",
+			opts.Authenticator, AWSCLIAuthenticator, IAMAuthenticator)
+	}
+	if opts.ProfileName != "" {
+		exec.Env = []kubeconfigExecEnv{{Name: "AWS_PROFILE", Value: opts.ProfileName}}
+	}
+
+	kubeconfig := kubeconfigFile{
+		APIVersion:     "v1",
+		Clusters:       make([]kubeconfigCluster, 1),
+		Contexts:       make([]kubeconfigContext, 1),
+		CurrentContext: "aws",
+		Kind:           "Config",
+		Users:          make([]kubeconfigUser, 1),
+	}
+	kubeconfig.Clusters[0].Cluster.Server = endpoint
+	kubeconfig.Clusters[0].Cluster.CertificateAuthorityData = certificateAuthorityData
+	kubeconfig.Clusters[0].Name = "kubernetes"
+	kubeconfig.Contexts[0].Context.Cluster = "kubernetes"
+	kubeconfig.Contexts[0].Context.User = "aws"
+	kubeconfig.Contexts[0].Name = "aws"
+	kubeconfig.Users[0].Name = "aws"
+	kubeconfig.Users[0].User.Exec = exec
+
+	// JSON.stringify does not escape HTML characters, nor end with a newline.
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(kubeconfig); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The golden files of the aws CLI authenticator in testdata/kubeconfig, i.e.
+// all but the iam-authenticator ones, are the JSON.stringify output of
+// generateKubeconfig in nodejs/eks/cluster.ts, for the same inputs. The
+// nodejs package cannot generate aws-iam-authenticator kubeconfigs, so the
+// iam-authenticator golden files were written by hand, from the default and
+// role-and-profile ones and the `aws-iam-authenticator token` flags.
+const (
+	goldenClusterName = "cluster-eksCluster-6a1b2c3"
+	goldenEndpoint    = "https://0123456789ABCDEF0123456789ABCDEF.gr7.us-west-2.eks.amazonaws.com"
+	goldenCAData      = "LS0tLS1CRUdJTiBDRVJUSUZJQ0FURS0tLS0tCk1JSUN5RENDQWJDZ0F3SUJBZ0lCQURBTkJna3Foa2lHOXcwQkFRc0ZBREFWTVJNd0VRWURWUVFERXdwcmRXSmwKLS0tLS1FTkQgQ0VSVElGSUNBVEUtLS0tLQo="
+	goldenRoleARN     = "arn:aws:iam::123456789012:role/eks/admins"
+)
+
+func TestGenerateKubeconfig(t *testing.T) {
+	for golden, opts := range map[string]KubeconfigOptions{
+		"default":          {},
+		"role":             {RoleARN: goldenRoleARN},
+		"profile":          {ProfileName: "dev"},
+		"role-and-profile": {RoleARN: goldenRoleARN, ProfileName: "dev"},
+		"escaping":         {ProfileName: `dev<&>"quoted"`},
+		"iam-authenticator": {
+			Authenticator: IAMAuthenticator,
+		},
+		"iam-authenticator-role-and-profile": {
+			RoleARN:       goldenRoleARN,
+			ProfileName:   "dev",
+			Authenticator: IAMAuthenticator,
+		},
+	} {
+		t.Run(golden, func(t *testing.T) {
+			expected, err := ioutil.ReadFile(filepath.Join("testdata", "kubeconfig", golden+".json"))
+			require.NoError(t, err)
+
+			kubeconfig, err := GenerateKubeconfig(goldenClusterName, goldenEndpoint, goldenCAData, opts)
+			require.NoError(t, err)
+			assert.Equal(t, string(expected), string(kubeconfig))
+
+			// The kubeconfig is valid, and names its cluster.
+			require.NoError(t, IsKubeconfigValid(kubeconfig))
+			clusterName, err := ClusterName(kubeconfig, nil)
+			require.NoError(t, err)
+			assert.Equal(t, goldenClusterName, clusterName)
+		})
+	}
+}
+
+func TestGenerateKubeconfigUnknownAuthenticator(t *testing.T) {
+	_, err := GenerateKubeconfig(goldenClusterName, goldenEndpoint, goldenCAData,
+		KubeconfigOptions{Authenticator: "kubectl"})
+	assert.EqualError(t, err, `unknown kubeconfig authenticator "kubectl": must be aws or aws-iam-authenticator`)
+}
@@ -0,0 +1,368 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/defaults"
+	"github.com/pulumi/pulumi/sdk/v2/go/common/apitype"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// KubeconfigLintCategory classifies a problem of a kubeconfig.
+type KubeconfigLintCategory string
+
+const (
+	// KubeconfigStructure is a kubeconfig that cannot be loaded, or that
+	// clientcmd.Validate rejects, e.g. due to a missing context.
+	KubeconfigStructure KubeconfigLintCategory = "Structure"
+	// KubeconfigCertificateAuthority is a cluster whose certificate authority
+	// is missing, does not decode to a valid PEM certificate, or is not
+	// verified.
+	KubeconfigCertificateAuthority KubeconfigLintCategory = "CertificateAuthority"
+	// KubeconfigServer is a cluster whose server is not an https URL.
+	KubeconfigServer KubeconfigLintCategory = "Server"
+	// KubeconfigExec is a user whose exec credential plugin is misconfigured,
+	// e.g. with an unsupported apiVersion or without a cluster name.
+	KubeconfigExec KubeconfigLintCategory = "Exec"
+	// KubeconfigEnv is an environment variable of an exec credential plugin
+	// that refers to nothing, e.g. an AWS_PROFILE that does not exist.
+	KubeconfigEnv KubeconfigLintCategory = "Env"
+	// KubeconfigStackMismatch is a kubeconfig that does not match the EKS
+	// cluster outputs of the stack, e.g. a server that is not the endpoint of
+	// the cluster.
+	KubeconfigStackMismatch KubeconfigLintCategory = "StackMismatch"
+)
+
+// supportedExecAPIVersions are the exec credential plugin apiVersions that
+// client-go supports.
+var supportedExecAPIVersions = map[string]bool{
+	"client.authentication.k8s.io/v1alpha1": true,
+	"client.authentication.k8s.io/v1beta1":  true,
+}
+
+// KubeconfigFinding is a problem of a kubeconfig.
+type KubeconfigFinding struct {
+	Category KubeconfigLintCategory
+	// Object is the kubeconfig entry at fault, e.g. `cluster "kubernetes"`,
+	// or "" for the kubeconfig as a whole.
+	Object string
+	// Message details the problem.
+	Message string
+}
+
+// String formats the finding as "Category: Object: Message".
+func (f KubeconfigFinding) String() string {
+	return joinNonEmpty(": ", string(f.Category), f.Object, f.Message)
+}
+
+// kubeconfigLinter collects the findings of a kubeconfig.
+type kubeconfigLinter struct {
+	findings []KubeconfigFinding
+	now      time.Time
+}
+
+func (l *kubeconfigLinter) addf(category KubeconfigLintCategory, object, format string, args ...interface{}) {
+	l.findings = append(l.findings, KubeconfigFinding{
+		Category: category,
+		Object:   object,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// LintKubeconfig checks a kubeconfig beyond its structure, as validated by
+// IsKubeconfigValid. It flags:
+//
+//   - certificate authorities that do not decode to a valid PEM certificate,
+//   - servers that are not https URLs,
+//   - exec credential plugins with an unsupported apiVersion, or `aws eks
+//     get-token` and `aws-iam-authenticator token` args without a cluster
+//     name,
+//   - exec credential plugin env vars that refer to nothing, e.g. an
+//     AWS_PROFILE that is not in the shared AWS config files,
+//   - a current context whose server, or certificate authority, differs from
+//     the outputs of its aws:eks/cluster:Cluster in resources, if given.
+//
+// It returns no findings if the kubeconfig is free of these problems.
+func LintKubeconfig(kubeconfig []byte, resources []apitype.ResourceV3) []KubeconfigFinding {
+	l := &kubeconfigLinter{now: time.Now()}
+
+	config, err := clientcmd.Load(kubeconfig)
+	if err != nil {
+		l.addf(KubeconfigStructure, "", "%v", err)
+		return l.findings
+	}
+	if err := clientcmd.Validate(*config); err != nil {
+		if agg, ok := err.(utilerrors.Aggregate); ok {
+			for _, e := range agg.Errors() {
+				l.addf(KubeconfigStructure, "", "%v", e)
+			}
+		} else {
+			l.addf(KubeconfigStructure, "", "%v", err)
+		}
+	}
+
+	clusterNames := make([]string, 0, len(config.Clusters))
+	for name := range config.Clusters {
+		clusterNames = append(clusterNames, name)
+	}
+	sort.Strings(clusterNames)
+	for _, name := range clusterNames {
+		l.lintCluster(fmt.Sprintf("cluster %q", name), config.Clusters[name])
+	}
+
+	userNames := make([]string, 0, len(config.AuthInfos))
+	for name := range config.AuthInfos {
+		userNames = append(userNames, name)
+	}
+	sort.Strings(userNames)
+	for _, name := range userNames {
+		if exec := config.AuthInfos[name].Exec; exec != nil {
+			l.lintExec(fmt.Sprintf("user %q", name), exec)
+		}
+	}
+	l.lintStack(kubeconfig, config, resources)
+	return l.findings
+}
+
+func (l *kubeconfigLinter) lintCluster(object string, cluster *clientcmdapi.Cluster) {
+	if cluster.Server != "" {
+		u, err := url.Parse(cluster.Server)
+		switch {
+		case err != nil:
+			l.addf(KubeconfigServer, object, "server %q is not a URL: %v", cluster.Server, err)
+		case u.Scheme != "https":
+			l.addf(KubeconfigServer, object, "server %q is not an https URL", cluster.Server)
+		case u.Host == "":
+			l.addf(KubeconfigServer, object, "server %q has no host", cluster.Server)
+		}
+	}
+
+	if cluster.InsecureSkipTLSVerify {
+		l.addf(KubeconfigCertificateAuthority, object, "TLS verification of the server is disabled")
+		return
+	}
+	switch {
+	case len(cluster.CertificateAuthorityData) > 0:
+		l.lintCertificate(object, "certificate-authority-data", cluster.CertificateAuthorityData)
+	case cluster.CertificateAuthority != "":
+		// clientcmd.Validate flags a missing file.
+		if data, err := ioutil.ReadFile(cluster.CertificateAuthority); err == nil {
+			l.lintCertificate(object, fmt.Sprintf("certificate-authority %s", cluster.CertificateAuthority), data)
+		}
+	default:
+		l.addf(KubeconfigCertificateAuthority, object,
+			"no certificate authority is set, so the server is verified with the system roots")
+	}
+}
+
+// lintCertificate flags certificate authority data that is not a PEM encoded
+// CA certificate, or that has expired. source names the data in findings.
+func (l *kubeconfigLinter) lintCertificate(object, source string, data []byte) {
+	var certificates int
+	for rest := bytes.TrimSpace(data); len(rest) > 0; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			l.addf(KubeconfigCertificateAuthority, object, "%s contains a %s PEM block, not a CERTIFICATE",
+				source, block.Type)
+			continue
+		}
+		certificates++
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			l.addf(KubeconfigCertificateAuthority, object, "%s is not a valid certificate: %v", source, err)
+			continue
+		}
+		if !cert.IsCA {
+			l.addf(KubeconfigCertificateAuthority, object, "%s certificate %q is not a CA certificate",
+				source, cert.Subject.CommonName)
+		}
+		if l.now.After(cert.NotAfter) {
+			l.addf(KubeconfigCertificateAuthority, object, "%s certificate %q expired on %s",
+				source, cert.Subject.CommonName, cert.NotAfter.Format(time.RFC3339))
+		}
+	}
+	if certificates == 0 {
+		l.addf(KubeconfigCertificateAuthority, object, "%s does not decode to a PEM certificate", source)
+	}
+}
+
+func (l *kubeconfigLinter) lintExec(object string, exec *clientcmdapi.ExecConfig) {
+	// clientcmd.Validate flags an empty apiVersion.
+	if exec.APIVersion != "" && !supportedExecAPIVersions[exec.APIVersion] {
+		l.addf(KubeconfigExec, object, "exec apiVersion %q is not supported by client-go", exec.APIVersion)
+	}
+	l.lintExecEnv(object, exec.Env)
+
+	switch filepath.Base(exec.Command) {
+	case "aws":
+		if !containsString(exec.Args, "get-token") {
+			l.addf(KubeconfigExec, object, "exec args %q are not `eks get-token`", exec.Args)
+		} else if execFlagValue(exec.Args, "--cluster-name") == "" {
+			l.addf(KubeconfigExec, object, "exec args %q have no --cluster-name", exec.Args)
+		}
+	case "aws-iam-authenticator":
+		if clusterNameFromExecArgs(exec.Args) == "" {
+			l.addf(KubeconfigExec, object, "exec args %q have no --cluster-id", exec.Args)
+		}
+	default:
+		return
+	}
+	if role := execFlagValue(exec.Args, "--role-arn", "--role", "-r"); role != "" &&
+		!(strings.HasPrefix(role, "arn:") && strings.Contains(role, ":role/")) {
+		l.addf(KubeconfigExec, object, "exec role %q is not an IAM role ARN", role)
+	}
+}
+
+// lintExecEnv flags the env vars of an exec credential plugin that refer
+// to nothing: shared AWS config files that do not exist, and an AWS_PROFILE
+// that is in neither of them.
+func (l *kubeconfigLinter) lintExecEnv(object string, env []clientcmdapi.ExecEnvVar) {
+	// The plugin inherits the environment of the process, overridden by env.
+	vars := make(map[string]string)
+	for _, e := range env {
+		vars[e.Name] = e.Value
+	}
+	getenv := func(name string) string {
+		if value, ok := vars[name]; ok {
+			return value
+		}
+		return os.Getenv(name)
+	}
+
+	// clientcmd.Validate flags empty values.
+	for _, e := range env {
+		switch e.Name {
+		case "AWS_CONFIG_FILE", "AWS_SHARED_CREDENTIALS_FILE":
+			if _, err := os.Stat(e.Value); e.Value != "" && err != nil {
+				l.addf(KubeconfigEnv, object, "env %s refers to a file that does not exist: %s", e.Name, e.Value)
+			}
+		}
+	}
+
+	if profile := vars["AWS_PROFILE"]; profile != "" {
+		configFile := getenv("AWS_CONFIG_FILE")
+		if configFile == "" {
+			configFile = defaults.SharedConfigFilename()
+		}
+		credentialsFile := getenv("AWS_SHARED_CREDENTIALS_FILE")
+		if credentialsFile == "" {
+			credentialsFile = defaults.SharedCredentialsFilename()
+		}
+		if !awsProfileExists(profile, credentialsFile, configFile) {
+			l.addf(KubeconfigEnv, object, "env AWS_PROFILE refers to nothing: AWS profile %q does not exist in %s or %s",
+				profile, credentialsFile, configFile)
+		}
+	}
+}
+
+// awsProfileExists reports whether a profile is in the shared AWS credentials
+// or config file, whether or not it has credentials of its own, e.g. when it
+// assumes a role.
+func awsProfileExists(profile, credentialsFile, configFile string) bool {
+	// Profiles of the config file, other than the default profile, are
+	// prefixed with "profile ".
+	configSection := "profile " + profile
+	if profile == "default" {
+		configSection = profile
+	}
+	for file, section := range map[string]string{credentialsFile: profile, configFile: configSection} {
+		// The shared credentials provider fails to load a file, or a profile
+		// it does not have, with SharedCredsLoad.
+		_, err := credentials.NewSharedCredentials(file, section).Get()
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != "SharedCredsLoad" {
+			return true
+		}
+	}
+	return false
+}
+
+// lintStack compares the current context of the kubeconfig to the outputs of
+// its EKS cluster in resources. It is skipped if resources have no EKS
+// clusters.
+func (l *kubeconfigLinter) lintStack(kubeconfig []byte, config *clientcmdapi.Config,
+	resources []apitype.ResourceV3) {
+	clusters := make(map[string]apitype.ResourceV3)
+	for _, res := range resources {
+		if res.Type.String() == clusterResourceType {
+			clusters[stringOutput(res, "name")] = res
+		}
+	}
+	if len(clusters) == 0 {
+		return
+	}
+	context, ok := config.Contexts[config.CurrentContext]
+	if !ok {
+		return
+	}
+	cluster, ok := config.Clusters[context.Cluster]
+	if !ok {
+		return
+	}
+	object := fmt.Sprintf("cluster %q", context.Cluster)
+
+	clusterName, err := ClusterName(kubeconfig, resources)
+	if err != nil {
+		l.addf(KubeconfigStackMismatch, object, "%v", err)
+		return
+	}
+	res, ok := clusters[clusterName]
+	if !ok {
+		l.addf(KubeconfigStackMismatch, object, "the stack has no %s named %q", clusterResourceType, clusterName)
+		return
+	}
+
+	if endpoint := stringOutput(res, "endpoint"); endpoint != "" &&
+		normalizeEndpoint(endpoint) != normalizeEndpoint(cluster.Server) {
+		l.addf(KubeconfigStackMismatch, object, "server %q is not the endpoint %q of EKS cluster %q",
+			cluster.Server, endpoint, clusterName)
+	}
+
+	if data := clusterCertificateAuthority(res); data != nil && len(cluster.CertificateAuthorityData) > 0 &&
+		!bytes.Equal(bytes.TrimSpace(data), bytes.TrimSpace(cluster.CertificateAuthorityData)) {
+		l.addf(KubeconfigStackMismatch, object,
+			"certificate-authority-data is not the certificate authority of EKS cluster %q", clusterName)
+	}
+}
+
+// clusterCertificateAuthority returns the decoded certificate authority data
+// of an EKS cluster resource, or nil if it has none.
+func clusterCertificateAuthority(res apitype.ResourceV3) []byte {
+	var authority interface{}
+	switch ca := unwrapSecrets(res.Outputs["certificateAuthority"]).(type) {
+	case map[string]interface{}:
+		authority = ca
+	case []interface{}:
+		if len(ca) > 0 {
+			authority = ca[0]
+		}
+	}
+	ca, _ := authority.(map[string]interface{})
+	encoded, _ := ca["data"].(string)
+	if encoded == "" {
+		return nil
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil
+	}
+	return data
+}
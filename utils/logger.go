@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"log"
+)
+
+// Logger receives the progress of waits and checks, so that they can be used
+// outside of Go tests. *testing.T is a Logger.
+type Logger interface {
+	Logf(format string, args ...interface{})
+}
+
+// LoggerFunc adapts a printf-like function, such as log.Printf, to a Logger.
+type LoggerFunc func(format string, args ...interface{})
+
+// Logf calls f.
+func (f LoggerFunc) Logf(format string, args ...interface{}) {
+	f(format, args...)
+}
+
+// DiscardLogger is a Logger that drops all output.
+var DiscardLogger Logger = LoggerFunc(func(string, ...interface{}) {})
+
+// NewWriterLogger creates a Logger that writes each message to w, prefixed
+// with the date and time. It is safe for concurrent use.
+func NewWriterLogger(w io.Writer) Logger {
+	l := log.New(w, "", log.LstdFlags)
+	return LoggerFunc(l.Printf)
+}
+
+// prefixLogger prefixes each message, e.g. with the name of the cluster it
+// is about.
+type prefixLogger struct {
+	prefix string
+	logger Logger
+}
+
+func (l *prefixLogger) Logf(format string, args ...interface{}) {
+	l.logger.Logf("%s%s", l.prefix, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,441 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pulumi/pulumi/sdk/v2/go/common/apitype"
+	"gopkg.in/yaml.v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// managedNodeGroupLabel is the label of the Nodes of an EKS managed node
+// group, whose value is the name of the group.
+const managedNodeGroupLabel = "eks.amazonaws.com/nodegroup"
+
+// nodeLabelsArg matches the `--node-labels` kubelet arg of the user data of a
+// self-managed node group, i.e. its NodeGroupOptions.labels.
+var nodeLabelsArg = regexp.MustCompile(`--node-labels=([^\s'"]+)`)
+
+// NodeGroupKind is the kind of a node group.
+type NodeGroupKind string
+
+const (
+	// SelfManagedNodeGroup is a node group backed by a CloudFormation stack
+	// of an Auto Scaling group, i.e. an eks.NodeGroup.
+	SelfManagedNodeGroup NodeGroupKind = "self-managed"
+	// ManagedNodeGroup is an EKS managed node group, i.e. an
+	// aws:eks/nodeGroup:NodeGroup.
+	ManagedNodeGroup NodeGroupKind = "managed"
+)
+
+// NodeGroup is a group of worker Nodes of an EKS cluster in the stack, and its
+// desired Node count.
+type NodeGroup struct {
+	// Name is the EKS name of a managed node group, or the name of a
+	// self-managed node group, i.e. of its CloudFormation stack without the
+	// "-nodes" suffix.
+	Name string        `json:"name"`
+	Kind NodeGroupKind `json:"kind"`
+	// DesiredCount is the desired Node count of the group.
+	DesiredCount int `json:"desiredCount"`
+	// AutoScalingGroupName is the Auto Scaling group of a self-managed node
+	// group, as output by its CloudFormation stack.
+	AutoScalingGroupName string `json:"autoScalingGroupName,omitempty"`
+	// Labels are the labels that the Nodes of the group are registered with.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// String names the group, e.g. `self-managed node group "ng"`.
+func (g NodeGroup) String() string {
+	return fmt.Sprintf("%s node group %q", g.Kind, g.Name)
+}
+
+// clusterNodeGroupsMap implements a map of Kubernetes cluster names to their
+// respective NodeGroups.
+type clusterNodeGroupsMap map[string][]NodeGroup
+
+// mapClusterToNodeGroups iterates through all Pulumi stack resources looking
+// for the node groups of each cluster: the CloudFormation stacks of
+// self-managed node groups, and AWS managed node groups.
+func mapClusterToNodeGroups(resources []apitype.ResourceV3) (clusterNodeGroupsMap, error) {
+	// The labels of self-managed Nodes are set in the user data of their
+	// launch configuration.
+	launchConfigLabels := make(map[string]map[string]string)
+	for _, res := range resources {
+		if res.Type.String() == "aws:ec2/launchConfiguration:LaunchConfiguration" {
+			userData, _ := unwrapSecrets(res.Inputs["userData"]).(string)
+			launchConfigLabels[stringOutput(res, "name")] = nodeLabelsFromUserData(userData)
+		}
+	}
+
+	clusterToNodeGroups := make(clusterNodeGroupsMap)
+	for _, res := range resources {
+		switch {
+		case strings.HasPrefix(res.ID.String(), "arn:aws:cloudformation"):
+			var templateBody cloudFormationTemplateBody
+			body, _ := res.Outputs["templateBody"].(string)
+			if err := yaml.Unmarshal([]byte(body), &templateBody); err != nil {
+				return nil, err
+			}
+			props := templateBody.Resources.NodeGroup.Properties
+			outputs, _ := res.Outputs["outputs"].(map[string]interface{})
+			asgName, _ := outputs["NodeGroup"].(string)
+
+			clusterName := nodeGroupClusterName(props.Tags)
+			clusterToNodeGroups[clusterName] = append(clusterToNodeGroups[clusterName], NodeGroup{
+				Name:                 strings.TrimSuffix(string(res.URN.Name()), "-nodes"),
+				Kind:                 SelfManagedNodeGroup,
+				DesiredCount:         props.DesiredCapacity,
+				AutoScalingGroupName: asgName,
+				Labels:               launchConfigLabels[props.LaunchConfigurationName],
+			})
+		case res.Type.String() == "aws:eks/nodeGroup:NodeGroup":
+			clusterName, _ := res.Inputs["clusterName"].(string)
+			if clusterName == "" {
+				return nil, fmt.Errorf("managed node group %s has no clusterName", res.URN)
+			}
+			scalingConfig, _ := res.Inputs["scalingConfig"].(map[string]interface{})
+			desiredSize, ok := scalingConfig["desiredSize"].(float64)
+			if !ok {
+				return nil, fmt.Errorf("managed node group %s has no scalingConfig.desiredSize", res.URN)
+			}
+
+			name := stringOutput(res, "nodeGroupName")
+			if name == "" {
+				name, _ = res.Inputs["nodeGroupName"].(string)
+			}
+			if name == "" {
+				name = string(res.URN.Name())
+			}
+			var labels map[string]string
+			if inputLabels, ok := res.Inputs["labels"].(map[string]interface{}); ok {
+				labels = make(map[string]string)
+				for key, value := range inputLabels {
+					labels[key] = fmt.Sprint(value)
+				}
+			}
+
+			clusterToNodeGroups[clusterName] = append(clusterToNodeGroups[clusterName], NodeGroup{
+				Name:         name,
+				Kind:         ManagedNodeGroup,
+				DesiredCount: int(desiredSize),
+				Labels:       labels,
+			})
+		}
+	}
+
+	for _, groups := range clusterToNodeGroups {
+		sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	}
+	return clusterToNodeGroups, nil
+}
+
+// nodeLabelsFromUserData returns the labels of the `--node-labels` kubelet
+// args in the user data of a self-managed node group.
+func nodeLabelsFromUserData(userData string) map[string]string {
+	var labels map[string]string
+	for _, match := range nodeLabelsArg.FindAllStringSubmatch(userData, -1) {
+		for _, label := range strings.Split(match[1], ",") {
+			if parts := strings.SplitN(label, "=", 2); len(parts) == 2 {
+				if labels == nil {
+					labels = make(map[string]string)
+				}
+				labels[parts[0]] = parts[1]
+			}
+		}
+	}
+	return labels
+}
+
+// NodeInstanceID returns the EC2 instance ID of a Node from its providerID,
+// e.g. "i-0123456789abcdef0" for "aws:///us-west-2a/i-0123456789abcdef0", or
+// "" if it has none.
+func NodeInstanceID(node *corev1.Node) string {
+	if !strings.HasPrefix(node.Spec.ProviderID, "aws://") {
+		return ""
+	}
+	id := node.Spec.ProviderID[strings.LastIndex(node.Spec.ProviderID, "/")+1:]
+	if !strings.HasPrefix(id, "i-") {
+		return ""
+	}
+	return id
+}
+
+// NodeGroupOf returns the group among groups that a Node belongs to, or nil if
+// it cannot be attributed to a single group. In order, a Node is attributed:
+//
+//   - by its eks.amazonaws.com/nodegroup label, to the managed node group of
+//     that name,
+//   - by the Auto Scaling group of its instance in instanceASGs, if given, to
+//     the self-managed node group of that Auto Scaling group,
+//   - by its labels, to the self-managed node group whose labels it has,
+//     preferring the group with the most labels.
+func NodeGroupOf(node *corev1.Node, groups []NodeGroup, instanceASGs map[string]string) *NodeGroup {
+	if i := nodeGroupIndex(node, groups, instanceASGs); i >= 0 {
+		return &groups[i]
+	}
+	return nil
+}
+
+// nodeGroupIndex returns the index of the group of a Node, as attributed by
+// NodeGroupOf, or -1.
+func nodeGroupIndex(node *corev1.Node, groups []NodeGroup, instanceASGs map[string]string) int {
+	if name, ok := node.Labels[managedNodeGroupLabel]; ok {
+		for i, g := range groups {
+			if g.Kind == ManagedNodeGroup && g.Name == name {
+				return i
+			}
+		}
+		return -1
+	}
+
+	if asgName := instanceASGs[NodeInstanceID(node)]; asgName != "" {
+		for i, g := range groups {
+			if g.Kind == SelfManagedNodeGroup && g.AutoScalingGroupName == asgName {
+				return i
+			}
+		}
+	}
+
+	match, ambiguous := -1, false
+	for i, g := range groups {
+		if g.Kind != SelfManagedNodeGroup || !hasLabels(node, g.Labels) {
+			continue
+		}
+		switch {
+		case match < 0 || len(g.Labels) > len(groups[match].Labels):
+			match, ambiguous = i, false
+		case len(g.Labels) == len(groups[match].Labels):
+			ambiguous = true
+		}
+	}
+	if ambiguous {
+		return -1
+	}
+	return match
+}
+
+// hasLabels reports whether a Node has all of labels.
+func hasLabels(node *corev1.Node, labels map[string]string) bool {
+	for key, value := range labels {
+		if v, ok := node.Labels[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// poolNodeGroups merges the self-managed node groups whose Nodes cannot be
+// told apart by their labels, i.e. that have the same labels, into a single
+// group whose desired count is their total. It also returns the names of the
+// groups merged into each pooled group.
+func poolNodeGroups(groups []NodeGroup) ([]NodeGroup, [][]string) {
+	var pooled []NodeGroup
+	var members [][]string
+	pools := make(map[string]int) // labels -> index in pooled
+	for _, g := range groups {
+		if g.Kind != SelfManagedNodeGroup {
+			pooled = append(pooled, g)
+			members = append(members, []string{g.Name})
+			continue
+		}
+		key := labelsKey(g.Labels)
+		i, ok := pools[key]
+		if !ok {
+			pools[key] = len(pooled)
+			pooled = append(pooled, g)
+			members = append(members, []string{g.Name})
+			continue
+		}
+		pooled[i].Name += "+" + g.Name
+		pooled[i].DesiredCount += g.DesiredCount
+		pooled[i].AutoScalingGroupName = ""
+		members[i] = append(members[i], g.Name)
+	}
+	return pooled, members
+}
+
+// labelsKey serializes labels in a canonical order.
+func labelsKey(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// NodeGroupStatus is the readiness of the Nodes attributed to a node group.
+type NodeGroupStatus struct {
+	NodeGroup
+	// Nodes are the names of the Nodes of the group.
+	Nodes []string `json:"nodes,omitempty"`
+	// ReadyCount is the count of the Nodes of the group that are ready.
+	ReadyCount int `json:"readyCount"`
+}
+
+// Ready reports whether the group has its desired count of Nodes, all of
+// which are ready.
+func (s NodeGroupStatus) Ready() bool {
+	return len(s.Nodes) == s.DesiredCount && s.ReadyCount == s.DesiredCount
+}
+
+// String summarizes the status, e.g. `self-managed node group "ng": 2 Nodes,
+// 1 ready, 2 desired`.
+func (s NodeGroupStatus) String() string {
+	return fmt.Sprintf("%s: %d Nodes, %d ready, %d desired", s.NodeGroup, len(s.Nodes), s.ReadyCount, s.DesiredCount)
+}
+
+// nodeGroupsStatus returns the readiness of each Node, the status of each
+// node group, and the findings that keep the Nodes from being checked against
+// their groups: Nodes that could not be attributed to any group and, without
+// instanceASGs, self-managed groups with the same labels, which are pooled as
+// their Nodes cannot be told apart. Findings are also part of the returned
+// readiness, as not ready.
+func nodeGroupsStatus(nodes []corev1.Node, groups []NodeGroup,
+	instanceASGs map[string]string) (ReadinessStatus, []NodeGroupStatus, []ObjectStatus) {
+	var status ReadinessStatus
+	var findings []ObjectStatus
+	if instanceASGs == nil {
+		var members [][]string
+		groups, members = poolNodeGroups(groups)
+		for i, names := range members {
+			if len(names) < 2 {
+				continue
+			}
+			findings = append(findings, ObjectStatus{
+				Kind: "NodeGroup",
+				Name: groups[i].Name,
+				Reason: fmt.Sprintf("cannot attribute Nodes to self-managed node groups %s, which have the same "+
+					"labels, without the Auto Scaling groups of their instances", strings.Join(names, ", ")),
+			})
+		}
+	}
+	groupStatuses := make([]NodeGroupStatus, len(groups))
+	for i, g := range groups {
+		groupStatuses[i].NodeGroup = g
+	}
+
+	var unattributed []ObjectStatus
+	for i := range nodes {
+		node := &nodes[i]
+		ready, reason := NodeReadiness(node)
+		nodeStatus := ObjectStatus{Kind: "Node", Name: node.Name, Ready: ready, Reason: reason}
+
+		groupIndex := nodeGroupIndex(node, groups, instanceASGs)
+		if groupIndex < 0 {
+			nodeStatus.Ready = false
+			nodeStatus.Reason = "not attributed to any node group"
+			if reason != "" {
+				nodeStatus.Reason = reason + ", and " + nodeStatus.Reason
+			}
+			unattributed = append(unattributed, nodeStatus)
+		} else {
+			s := &groupStatuses[groupIndex]
+			s.Nodes = append(s.Nodes, node.Name)
+			if ready {
+				s.ReadyCount++
+			}
+		}
+		status.Objects = append(status.Objects, nodeStatus)
+	}
+
+	sort.Slice(status.Objects, func(i, j int) bool {
+		return status.Objects[i].Name < status.Objects[j].Name
+	})
+	for _, s := range groupStatuses {
+		sort.Strings(s.Nodes)
+	}
+	sort.Slice(unattributed, func(i, j int) bool {
+		return unattributed[i].Name < unattributed[j].Name
+	})
+	status.Objects = append(status.Objects, findings...)
+	return status, groupStatuses, append(findings, unattributed...)
+}
+
+// nodeInstanceIDs returns the EC2 instance IDs of Nodes.
+func nodeInstanceIDs(nodes []corev1.Node) []string {
+	var ids []string
+	for i := range nodes {
+		if id := NodeInstanceID(&nodes[i]); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// WaitForNodeGroupsReady waits for each node group to have its desired count
+// of Nodes, all of which are ready, polling with the default backoff. Nodes
+// are attributed to their group with NodeGroupOf, by the Auto Scaling groups
+// of their instances if resolver is not nil.
+func WaitForNodeGroupsReady(ctx context.Context, logger Logger, clientset kubernetes.Interface,
+	groups []NodeGroup, resolver AutoScalingGroupResolver) (ReadinessStatus, error) {
+	return waitForNodeGroupsReady(ctx, logger, DefaultSmokeTestOptions().newBackoff(), clientset, groups, resolver)
+}
+
+func waitForNodeGroupsReady(ctx context.Context, logger Logger, b *backoff, clientset kubernetes.Interface,
+	groups []NodeGroup, resolver AutoScalingGroupResolver) (ReadinessStatus, error) {
+	selfManaged := false
+	for _, g := range groups {
+		logger.Logf("Desired Worker Node Count of %s: %d\n", g, g.DesiredCount)
+		selfManaged = selfManaged || g.Kind == SelfManagedNodeGroup
+	}
+
+	var status ReadinessStatus
+	var groupStatuses []NodeGroupStatus
+	var findings []ObjectStatus
+	err := waitUntil(ctx, logger, b, "Node groups", "ready", func() (bool, error) {
+		nodes, err := clientset.CoreV1().Nodes().List(metav1.ListOptions{})
+		if err != nil {
+			return false, err
+		}
+		var instanceASGs map[string]string
+		if resolver != nil && selfManaged {
+			// Fall back to attributing Nodes by their labels.
+			if instanceASGs, err = resolver.InstanceAutoScalingGroups(nodeInstanceIDs(nodes.Items)); err != nil {
+				logger.Logf("Unable to resolve the Auto Scaling groups of the Nodes: %v\n", err)
+			}
+		}
+		status, groupStatuses, findings = nodeGroupsStatus(nodes.Items, groups, instanceASGs)
+		for _, s := range groupStatuses {
+			if !s.Ready() {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+
+	var problems []string
+	for _, s := range groupStatuses {
+		if !s.Ready() {
+			problems = append(problems, s.String())
+		}
+	}
+	notReady := len(problems)
+	if err != nil && notReady == 0 {
+		return status, err
+	}
+	for _, f := range findings {
+		problems = append(problems, fmt.Sprintf("%s: %s", f, f.Reason))
+	}
+	if err != nil {
+		return status, fmt.Errorf("%d out of %d node groups are not ready: [%s]: %w",
+			notReady, len(groupStatuses), strings.Join(problems, ", "), err)
+	}
+
+	for _, s := range groupStatuses {
+		logger.Logf("%s\n", s)
+	}
+	if len(findings) > 0 {
+		// The counts of the groups cannot be trusted.
+		return status, fmt.Errorf("%d Nodes or node groups cannot be attributed: [%s]",
+			len(findings), strings.Join(problems, ", "))
+	}
+	return status, nil
+}
@@ -0,0 +1,331 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/pulumi/pulumi/sdk/v2/go/common/apitype"
+	"github.com/pulumi/pulumi/sdk/v2/go/common/resource"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const testNodeGroupTemplate = `
+AWSTemplateFormatVersion: '2010-09-09'
+Outputs:
+    NodeGroup:
+        Value: !Ref NodeGroup
+Resources:
+    NodeGroup:
+        Type: AWS::AutoScaling::AutoScalingGroup
+        Properties:
+          DesiredCapacity: %d
+          LaunchConfigurationName: %s
+          MinSize: 1
+          MaxSize: 3
+          Tags:
+          - Key: Name
+            Value: cluster-eksCluster-1234567-worker
+            PropagateAtLaunch: 'true'
+`
+
+func testNodeGroupResources() []apitype.ResourceV3 {
+	userData := "#!/bin/bash\n\n/etc/eks/bootstrap.sh --apiserver-endpoint \"https://abc\" " +
+		"--b64-cluster-ca \"ca\" \"cluster-eksCluster-1234567\" --kubelet-extra-args " +
+		"'--node-labels=ondemand=true,tier=web --register-with-taints=special=true:NoSchedule'\n"
+	return []apitype.ResourceV3{
+		{
+			URN:     resource.URN("urn:pulumi:dev::eks::aws:ec2/launchConfiguration:LaunchConfiguration::ng-ondemand-nodeLaunchConfiguration"),
+			Type:    "aws:ec2/launchConfiguration:LaunchConfiguration",
+			Inputs:  map[string]interface{}{"userData": userData},
+			Outputs: map[string]interface{}{"name": "ng-ondemand-lc"},
+		},
+		{
+			URN:     resource.URN("urn:pulumi:dev::eks::aws:ec2/launchConfiguration:LaunchConfiguration::cluster-nodeLaunchConfiguration"),
+			Type:    "aws:ec2/launchConfiguration:LaunchConfiguration",
+			Inputs:  map[string]interface{}{"userData": "#!/bin/bash\n/etc/eks/bootstrap.sh cluster\n"},
+			Outputs: map[string]interface{}{"name": "cluster-lc"},
+		},
+		{
+			URN:  resource.URN("urn:pulumi:dev::eks::aws:cloudformation/stack:Stack::ng-ondemand-nodes"),
+			Type: "aws:cloudformation/stack:Stack",
+			ID:   "arn:aws:cloudformation:us-west-2:123456789012:stack/ng-ondemand/1",
+			Outputs: map[string]interface{}{
+				"templateBody": fmt.Sprintf(testNodeGroupTemplate, 2, "ng-ondemand-lc"),
+				"outputs":      map[string]interface{}{"NodeGroup": "ng-ondemand-asg"},
+			},
+		},
+		{
+			URN:  resource.URN("urn:pulumi:dev::eks::aws:cloudformation/stack:Stack::cluster-nodes"),
+			Type: "aws:cloudformation/stack:Stack",
+			ID:   "arn:aws:cloudformation:us-west-2:123456789012:stack/cluster/1",
+			Outputs: map[string]interface{}{
+				"templateBody": fmt.Sprintf(testNodeGroupTemplate, 1, "cluster-lc"),
+				"outputs":      map[string]interface{}{"NodeGroup": "cluster-asg"},
+			},
+		},
+		{
+			URN:  resource.URN("urn:pulumi:dev::eks::aws:eks/nodeGroup:NodeGroup::managed-ng"),
+			Type: "aws:eks/nodeGroup:NodeGroup",
+			Inputs: map[string]interface{}{
+				"clusterName":   "cluster-eksCluster-1234567",
+				"scalingConfig": map[string]interface{}{"desiredSize": float64(3)},
+			},
+			Outputs: map[string]interface{}{"nodeGroupName": "managed-ng-abc"},
+		},
+	}
+}
+
+func testNode(name, providerID string, ready bool, labels map[string]string) corev1.Node {
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+	return corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+		Spec:       corev1.NodeSpec{ProviderID: providerID},
+		Status: corev1.NodeStatus{Conditions: []corev1.NodeCondition{
+			{Type: corev1.NodeReady, Status: status},
+		}},
+	}
+}
+
+func TestMapClusterToNodeGroups(t *testing.T) {
+	clusterToNodeGroups, err := mapClusterToNodeGroups(testNodeGroupResources())
+	require.NoError(t, err)
+	assert.Equal(t, clusterNodeGroupsMap{
+		"cluster-eksCluster-1234567": {
+			{Name: "cluster", Kind: SelfManagedNodeGroup, DesiredCount: 1, AutoScalingGroupName: "cluster-asg"},
+			{Name: "managed-ng-abc", Kind: ManagedNodeGroup, DesiredCount: 3},
+			{
+				Name:                 "ng-ondemand",
+				Kind:                 SelfManagedNodeGroup,
+				DesiredCount:         2,
+				AutoScalingGroupName: "ng-ondemand-asg",
+				Labels:               map[string]string{"ondemand": "true", "tier": "web"},
+			},
+		},
+	}, clusterToNodeGroups)
+
+	clusterToNodeCount, err := mapClusterToNodeCount(testNodeGroupResources())
+	require.NoError(t, err)
+	assert.Equal(t, clusterNodeCountMap{"cluster-eksCluster-1234567": 6}, clusterToNodeCount)
+}
+
+func TestNodeGroupOf(t *testing.T) {
+	clusterToNodeGroups, err := mapClusterToNodeGroups(testNodeGroupResources())
+	require.NoError(t, err)
+	groups := clusterToNodeGroups["cluster-eksCluster-1234567"]
+
+	for _, tc := range []struct {
+		node         corev1.Node
+		instanceASGs map[string]string
+		expected     string
+	}{
+		{testNode("managed", "", true, map[string]string{managedNodeGroupLabel: "managed-ng-abc"}), nil,
+			"managed-ng-abc"},
+		{testNode("other-managed", "", true, map[string]string{managedNodeGroupLabel: "other"}), nil, ""},
+		{testNode("labeled", "", true, map[string]string{"ondemand": "true", "tier": "web"}), nil,
+			"ng-ondemand"},
+		{testNode("default", "", true, map[string]string{"kubernetes.io/os": "linux"}), nil, "cluster"},
+		// The Auto Scaling group of the instance takes precedence over labels.
+		{testNode("asg", "aws:///us-west-2a/i-0123456789abcdef0", true, nil),
+			map[string]string{"i-0123456789abcdef0": "ng-ondemand-asg"}, "ng-ondemand"},
+	} {
+		g := NodeGroupOf(&tc.node, groups, tc.instanceASGs)
+		if tc.expected == "" {
+			assert.Nil(t, g, tc.node.Name)
+		} else if assert.NotNil(t, g, tc.node.Name) {
+			assert.Equal(t, tc.expected, g.Name, tc.node.Name)
+		}
+	}
+
+	// Groups with the same labels cannot be told apart.
+	twins := []NodeGroup{
+		{Name: "a", Kind: SelfManagedNodeGroup, DesiredCount: 1},
+		{Name: "b", Kind: SelfManagedNodeGroup, DesiredCount: 2},
+	}
+	node := testNode("twin", "", true, nil)
+	assert.Nil(t, NodeGroupOf(&node, twins, nil))
+	pooled, members := poolNodeGroups(twins)
+	assert.Equal(t, []NodeGroup{{Name: "a+b", Kind: SelfManagedNodeGroup, DesiredCount: 3}}, pooled)
+	assert.Equal(t, [][]string{{"a", "b"}}, members)
+}
+
+func TestNodeGroupsStatus(t *testing.T) {
+	groups := []NodeGroup{
+		{Name: "cluster", Kind: SelfManagedNodeGroup, DesiredCount: 2},
+		{Name: "ng-ondemand", Kind: SelfManagedNodeGroup, DesiredCount: 2, Labels: map[string]string{"ondemand": "true"}},
+		{Name: "managed", Kind: ManagedNodeGroup, DesiredCount: 1},
+	}
+	ondemand := map[string]string{"ondemand": "true"}
+	nodes := []corev1.Node{
+		// The default group is short a Node, which the total count of four
+		// would mask, as ng-ondemand has one too many.
+		testNode("node-1", "", true, nil),
+		testNode("node-2", "", true, ondemand),
+		testNode("node-3", "", true, ondemand),
+		testNode("node-4", "", false, ondemand),
+		testNode("node-5", "", true, map[string]string{managedNodeGroupLabel: "other"}),
+	}
+
+	status, groupStatuses, findings := nodeGroupsStatus(nodes, groups, nil)
+	assert.Len(t, status.Objects, 5)
+	unattributed := ObjectStatus{Kind: "Node", Name: "node-5", Reason: "not attributed to any node group"}
+	assert.Equal(t, []ObjectStatus{unattributed}, findings)
+	assert.Equal(t, unattributed, status.Objects[4])
+	require.Len(t, groupStatuses, 3)
+	assert.Equal(t, `self-managed node group "cluster": 1 Nodes, 1 ready, 2 desired`, groupStatuses[0].String())
+	assert.Equal(t, `self-managed node group "ng-ondemand": 3 Nodes, 2 ready, 2 desired`, groupStatuses[1].String())
+	assert.Equal(t, `managed node group "managed": 0 Nodes, 0 ready, 1 desired`, groupStatuses[2].String())
+	for _, s := range groupStatuses {
+		assert.False(t, s.Ready(), s.Name)
+	}
+}
+
+// staticResolver resolves the Auto Scaling groups of instances from a map.
+type staticResolver map[string]string
+
+func (r staticResolver) InstanceAutoScalingGroups([]string) (map[string]string, error) {
+	return r, nil
+}
+
+func TestWaitForNodeGroupsReady(t *testing.T) {
+	twins := []NodeGroup{
+		{Name: "a", Kind: SelfManagedNodeGroup, DesiredCount: 1, AutoScalingGroupName: "a-asg"},
+		{Name: "b", Kind: SelfManagedNodeGroup, DesiredCount: 1, AutoScalingGroupName: "b-asg"},
+	}
+	nodeA := testNode("node-a", "aws:///us-west-2a/i-a", true, nil)
+	nodeB := testNode("node-b", "aws:///us-west-2a/i-b", true, nil)
+	stray := testNode("node-c", "aws:///us-west-2a/i-c", true, map[string]string{managedNodeGroupLabel: "other"})
+	resolver := staticResolver{"i-a": "a-asg", "i-b": "b-asg"}
+
+	for name, tc := range map[string]struct {
+		nodes    []corev1.Node
+		resolver AutoScalingGroupResolver
+		err      string
+	}{
+		"attributed by Auto Scaling group": {nodes: []corev1.Node{nodeA, nodeB}, resolver: resolver},
+		"same labels without a resolver": {
+			nodes: []corev1.Node{nodeA, nodeB},
+			err: "1 Nodes or node groups cannot be attributed: [NodeGroup a+b: cannot attribute Nodes to " +
+				"self-managed node groups a, b, which have the same labels, without the Auto Scaling groups " +
+				"of their instances]",
+		},
+		"unattributed Node": {
+			nodes:    []corev1.Node{nodeA, nodeB, stray},
+			resolver: resolver,
+			err:      "1 Nodes or node groups cannot be attributed: [Node node-c: not attributed to any node group]",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			server := nodeServer(t, tc.nodes...)
+			defer server.Close()
+			clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+			require.NoError(t, err)
+
+			// Findings fail the check as soon as the groups are ready,
+			// rather than at the deadline.
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			b := &backoff{interval: time.Millisecond, max: time.Millisecond, factor: 1}
+			status, err := waitForNodeGroupsReady(ctx, DiscardLogger, b, clientset, twins, tc.resolver)
+			if tc.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.err)
+			}
+			assert.Equal(t, len(tc.nodes), status.Count("Node"))
+		})
+	}
+}
+
+func TestStackAWSRegion(t *testing.T) {
+	provider := func(name, region string) apitype.ResourceV3 {
+		return apitype.ResourceV3{
+			URN:    resource.URN("urn:pulumi:dev::eks::pulumi:providers:aws::" + name),
+			Type:   "pulumi:providers:aws",
+			Inputs: map[string]interface{}{"region": region},
+		}
+	}
+	assert.Equal(t, "", stackAWSRegion(testNodeGroupResources()))
+	assert.Equal(t, "us-west-2", stackAWSRegion([]apitype.ResourceV3{
+		provider("explicit", "eu-west-1"),
+		provider("default_2_13_1", "us-west-2"),
+	}))
+}
+
+func TestAutoScalingClient(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		form, err := url.ParseQuery(string(body))
+		require.NoError(t, err)
+		assert.Equal(t, "DescribeAutoScalingInstances", form.Get("Action"))
+		assert.Contains(t, r.Header.Get("Authorization"), "Credential=AKIDEXAMPLE/")
+		assert.Contains(t, r.Header.Get("Authorization"), "/us-west-2/autoscaling/aws4_request")
+		calls++
+		if form.Get("InstanceIds.member.1") == "i-unknown" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "<ErrorResponse><Error><Type>Sender</Type><Code>ValidationError</Code>"+
+				"<Message>invalid instance</Message></Error><RequestId>1</RequestId></ErrorResponse>")
+			return
+		}
+		var members strings.Builder
+		for i := 1; form.Get(fmt.Sprintf("InstanceIds.member.%d", i)) != ""; i++ {
+			fmt.Fprintf(&members, `
+      <member>
+        <InstanceId>%s</InstanceId>
+        <AutoScalingGroupName>ng-ondemand-asg</AutoScalingGroupName>
+      </member>`, form.Get(fmt.Sprintf("InstanceIds.member.%d", i)))
+		}
+		fmt.Fprintf(w, `<DescribeAutoScalingInstancesResponse>
+  <DescribeAutoScalingInstancesResult>
+    <AutoScalingInstances>%s
+    </AutoScalingInstances>
+  </DescribeAutoScalingInstancesResult>
+</DescribeAutoScalingInstancesResponse>`, members.String())
+	}))
+	defer server.Close()
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("us-west-2"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", ""),
+		MaxRetries:  aws.Int(0),
+	})
+	require.NoError(t, err)
+	client := &AutoScalingClient{API: autoscaling.New(sess)}
+
+	// Instances are described 50 at a time.
+	instanceIDs := make([]string, 51)
+	expected := make(map[string]string)
+	for i := range instanceIDs {
+		instanceIDs[i] = fmt.Sprintf("i-%017x", i)
+		expected[instanceIDs[i]] = "ng-ondemand-asg"
+	}
+	groups, err := client.InstanceAutoScalingGroups(instanceIDs)
+	require.NoError(t, err)
+	assert.Equal(t, expected, groups)
+	assert.Equal(t, 2, calls)
+
+	_, err = client.InstanceAutoScalingGroups([]string{"i-unknown"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "describing Auto Scaling instances: ValidationError: invalid instance")
+}
@@ -0,0 +1,163 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// nodeProblemConditions are the Node conditions that signal a problem when
+// True, even if the Node is Ready.
+var nodeProblemConditions = []corev1.NodeConditionType{
+	corev1.NodeMemoryPressure,
+	corev1.NodeDiskPressure,
+	corev1.NodePIDPressure,
+	corev1.NodeNetworkUnavailable,
+}
+
+// nodeTaintPrefix is the prefix of the taints that the Node controller and
+// kubelet set on unhealthy Nodes, e.g. node.kubernetes.io/unreachable.
+const nodeTaintPrefix = "node.kubernetes.io/"
+
+// NodeFinding is a health problem of a Node.
+type NodeFinding struct {
+	// Node is the name of the Node.
+	Node string
+	// Problem is the condition or state at fault, e.g. "DiskPressure".
+	Problem string
+	// Message details the problem, e.g. the message of the condition.
+	Message string
+}
+
+// String formats the finding as "Node NAME: Problem: Message".
+func (f NodeFinding) String() string {
+	if f.Message == "" {
+		return fmt.Sprintf("Node %s: %s", f.Node, f.Problem)
+	}
+	return fmt.Sprintf("Node %s: %s: %s", f.Node, f.Problem, f.Message)
+}
+
+// NodeHealth validates the health of a Node beyond its Ready condition. It
+// flags Nodes that are not Ready, are under memory, disk or PID pressure,
+// have an unavailable network, are cordoned, or have a node.kubernetes.io
+// NoExecute taint.
+func NodeHealth(node *corev1.Node) []NodeFinding {
+	var findings []NodeFinding
+	if ready, reason := NodeReadiness(node); !ready {
+		findings = append(findings, NodeFinding{Node: node.Name, Problem: "NotReady", Message: reason})
+	}
+
+	for _, conditionType := range nodeProblemConditions {
+		for _, condition := range node.Status.Conditions {
+			if condition.Type == conditionType && condition.Status == corev1.ConditionTrue {
+				findings = append(findings, NodeFinding{
+					Node:    node.Name,
+					Problem: string(condition.Type),
+					Message: condition.Message,
+				})
+			}
+		}
+	}
+
+	if node.Spec.Unschedulable {
+		findings = append(findings, NodeFinding{Node: node.Name, Problem: "Cordoned", Message: "node is unschedulable"})
+	}
+
+	for _, taint := range node.Spec.Taints {
+		if strings.HasPrefix(taint.Key, nodeTaintPrefix) && taint.Effect == corev1.TaintEffectNoExecute {
+			findings = append(findings, NodeFinding{
+				Node:    node.Name,
+				Problem: "Tainted",
+				Message: fmt.Sprintf("%s:%s", taint.Key, taint.Effect),
+			})
+		}
+	}
+	return findings
+}
+
+// nodeHealthStatus returns the health of each Node as an ObjectStatus, and
+// all of their findings.
+func nodeHealthStatus(nodes []corev1.Node) (ReadinessStatus, []NodeFinding) {
+	var status ReadinessStatus
+	var findings []NodeFinding
+	for i := range nodes {
+		node := &nodes[i]
+		nodeFindings := NodeHealth(node)
+		o := ObjectStatus{Kind: "Node", Name: node.Name, Ready: len(nodeFindings) == 0}
+		if !o.Ready {
+			problems := make([]string, len(nodeFindings))
+			for j, f := range nodeFindings {
+				problems[j] = f.Problem
+				if f.Message != "" {
+					problems[j] += ": " + f.Message
+				}
+			}
+			o.Reason = strings.Join(problems, "; ")
+		}
+		status.Objects = append(status.Objects, o)
+		findings = append(findings, nodeFindings...)
+	}
+	sort.Slice(status.Objects, func(i, j int) bool {
+		return status.Objects[i].Name < status.Objects[j].Name
+	})
+	return status, findings
+}
+
+// WaitForHealthyNodes waits for all Nodes to be free of NodeHealth findings,
+// following them with a ReadinessTracker.
+func WaitForHealthyNodes(ctx context.Context, logger Logger, clientset kubernetes.Interface) (ReadinessStatus, error) {
+	tracker, err := NewReadinessTracker(clientset, "nodes")
+	if err != nil {
+		return ReadinessStatus{}, err
+	}
+	tracker.Logger = logger
+
+	var status ReadinessStatus
+	var findings []NodeFinding
+	_, err = tracker.WaitForReady(ctx, func(ReadinessStatus) bool {
+		var nodes []corev1.Node
+		for _, obj := range tracker.trackedObjects("Node") {
+			nodes = append(nodes, *obj.(*corev1.Node))
+		}
+		status, findings = nodeHealthStatus(nodes)
+		return len(findings) == 0
+	})
+	// The tracker only reports the Nodes that are not Ready, rather than
+	// unhealthy.
+	var notReadyErr *NotReadyError
+	if errors.As(err, &notReadyErr) {
+		err = notReadyErr.Err
+	}
+	if err != nil && len(findings) > 0 {
+		problems := make([]string, len(findings))
+		for i, f := range findings {
+			problems[i] = f.String()
+		}
+		return status, fmt.Errorf("%d Node health problems: [%s]: %w", len(findings), strings.Join(problems, ", "), err)
+	}
+	if err != nil {
+		return status, err
+	}
+
+	logger.Logf("%d out of %d Nodes are healthy\n", len(status.Objects), len(status.Objects))
+	return status, nil
+}
+
+// NodeHealthCheck ensures that no Node is under pressure, cordoned, or
+// tainted as unhealthy. See NodeHealth. It is disabled in the
+// DefaultCheckRegistry, as Nodes are expected to be cordoned, tainted and
+// under pressure while they are drained, e.g. when migrating node groups.
+func NodeHealthCheck() Check {
+	return &readinessCheck{
+		name:      NodeHealthCheckName,
+		dependsOn: []string{NodesCheckName},
+		wait: func(ctx context.Context, env *CheckEnv) (ReadinessStatus, error) {
+			return WaitForHealthyNodes(ctx, env.Logger, env.KubeAccess.Clientset)
+		},
+	}
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// nodeServer serves a list of Nodes, and watches on them that never change.
+func nodeServer(t *testing.T, nodes ...corev1.Node) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/nodes", r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("watch") == "true" {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		list := corev1.NodeList{
+			TypeMeta: metav1.TypeMeta{Kind: "NodeList", APIVersion: "v1"},
+			ListMeta: metav1.ListMeta{ResourceVersion: "1"},
+			Items:    nodes,
+		}
+		assert.NoError(t, json.NewEncoder(w).Encode(list))
+	}))
+}
+
+func TestWaitForHealthyNodes(t *testing.T) {
+	ready := []corev1.NodeCondition{{Type: corev1.NodeReady, Status: corev1.ConditionTrue}}
+	healthy := corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-1"},
+		Status:     corev1.NodeStatus{Conditions: ready},
+	}
+	cordoned := corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-2"},
+		Spec:       corev1.NodeSpec{Unschedulable: true},
+		Status:     corev1.NodeStatus{Conditions: ready},
+	}
+
+	for name, tc := range map[string]struct {
+		nodes []corev1.Node
+		err   string
+	}{
+		"healthy": {nodes: []corev1.Node{healthy}},
+		"cordoned": {
+			nodes: []corev1.Node{healthy, cordoned},
+			err:   "1 Node health problems: [Node node-2: Cordoned: node is unschedulable]: context deadline exceeded",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			server := nodeServer(t, tc.nodes...)
+			defer server.Close()
+			clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+			status, err := WaitForHealthyNodes(ctx, DiscardLogger, clientset)
+			if tc.err == "" {
+				require.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.err)
+			}
+			assert.Len(t, status.Objects, len(tc.nodes))
+		})
+	}
+}
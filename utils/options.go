@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// Names of the default checks run by the EKS smoke test. Check names are used
+// as keys in SmokeTestOptions.CheckTimeouts.
+const (
+	AWSAuthCheckName         = "aws-auth"
+	NodesCheckName           = "nodes"
+	PodsCheckName            = "pods"
+	DaemonSetsCheckName      = "daemonsets"
+	ControlPlaneCheckName    = "control-plane"
+	APIServicesCheckName     = "apiservices"
+	NodeHealthCheckName      = "node-health"
+	AWSAuthMappingsCheckName = "aws-auth-mappings"
+)
+
+// SmokeTestOptions configures how the EKS smoke test waits on a cluster.
+//
+// Each check is given its own overall deadline, and polls the Kubernetes API
+// Server with an exponential backoff until it succeeds, its deadline passes, or
+// the Context is cancelled.
+type SmokeTestOptions struct {
+	// Context bounds the entire smoke test. Cancelling it ends all waits.
+	// Defaults to context.Background().
+	Context context.Context
+
+	// Timeout is the overall deadline of a single check, unless overridden in
+	// CheckTimeouts.
+	Timeout time.Duration
+
+	// CheckTimeouts overrides Timeout for individual checks, keyed by check
+	// name, e.g. "nodes".
+	CheckTimeouts map[string]time.Duration
+
+	// PollInterval is the initial amount of time to wait in between requests
+	// to the Kubernetes API Server.
+	PollInterval time.Duration
+
+	// MaxPollInterval caps the poll interval as it backs off.
+	MaxPollInterval time.Duration
+
+	// BackoffFactor is the multiplier applied to the poll interval after each
+	// unsuccessful attempt. A factor of 1 polls at a fixed interval.
+	BackoffFactor float64
+
+	// Checks are the checks to run against each cluster. Defaults to
+	// DefaultCheckRegistry().
+	Checks *CheckRegistry
+
+	// Parallelism limits how many clusters are tested at once, each in its
+	// own subtest. Zero tests all clusters in parallel; 1 tests them one
+	// after another.
+	Parallelism int
+
+	// Filter scopes the objects checked for readiness by the pods and
+	// daemonsets checks, and by ResourcesChecks. Node readiness is not
+	// filtered, as all Nodes count towards the desired Node count.
+	Filter ReadinessFilter
+
+	// AutoScaling resolves the Auto Scaling groups of the instances of Nodes,
+	// to attribute them to their self-managed node group. It defaults to an
+	// AutoScalingClient of the region of the stack's default AWS provider,
+	// i.e. its aws:region config. Without either, Nodes are attributed by
+	// their labels alone, and node groups with the same labels cannot be
+	// checked.
+	AutoScaling AutoScalingGroupResolver
+
+	// Logger receives the progress of RunSmokeTest, prefixed with the name of
+	// each cluster. Defaults to standard error. RunEKSSmokeTest logs to the
+	// *testing.T of each cluster's subtest instead.
+	Logger Logger
+}
+
+// DefaultSmokeTestOptions returns the options used by RunEKSSmokeTest.
+//
+// The default deadline of each check matches the previous worst case wait of
+// MaxRetries attempts, RetryInterval seconds apart.
+func DefaultSmokeTestOptions() SmokeTestOptions {
+	return SmokeTestOptions{
+		Context:         context.Background(),
+		Timeout:         MaxRetries * RetryInterval * time.Second,
+		PollInterval:    2 * time.Second,
+		MaxPollInterval: RetryInterval * time.Second,
+		BackoffFactor:   2,
+	}
+}
+
+// withDefaults returns a copy of the options with any unset fields populated
+// from DefaultSmokeTestOptions.
+func (o SmokeTestOptions) withDefaults() SmokeTestOptions {
+	defaults := DefaultSmokeTestOptions()
+	if o.Context == nil {
+		o.Context = defaults.Context
+	}
+	if o.Checks == nil {
+		o.Checks = DefaultCheckRegistry()
+	}
+	if o.Logger == nil {
+		o.Logger = NewWriterLogger(os.Stderr)
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = defaults.Timeout
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = defaults.PollInterval
+	}
+	if o.MaxPollInterval <= 0 {
+		o.MaxPollInterval = defaults.MaxPollInterval
+	}
+	if o.MaxPollInterval < o.PollInterval {
+		o.MaxPollInterval = o.PollInterval
+	}
+	if o.BackoffFactor < 1 {
+		o.BackoffFactor = defaults.BackoffFactor
+	}
+	return o
+}
+
+// timeoutFor returns the overall deadline of the named check.
+func (o SmokeTestOptions) timeoutFor(check string) time.Duration {
+	if timeout, ok := o.CheckTimeouts[check]; ok && timeout > 0 {
+		return timeout
+	}
+	return o.Timeout
+}
+
+// newBackoff returns a fresh backoff for a single wait.
+func (o SmokeTestOptions) newBackoff() *backoff {
+	return &backoff{
+		interval: o.PollInterval,
+		max:      o.MaxPollInterval,
+		factor:   o.BackoffFactor,
+	}
+}
@@ -0,0 +1,238 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+)
+
+// impersonatedGroupUser is the user impersonated to review the permissions of
+// a subject that is only a set of groups, as Kubernetes cannot impersonate
+// groups without a user.
+const impersonatedGroupUser = "eks-smoke-test"
+
+// authenticatedGroup is the group of all authenticated users, which the API
+// Server adds to the groups of every request.
+const authenticatedGroup = "system:authenticated"
+
+// Permission is an action on a resource that is expected to be allowed, or
+// denied.
+type Permission struct {
+	// Verb is the action, e.g. "get", "list" or "create".
+	Verb string
+	// Group is the API group of the resource, "" for the core group.
+	Group string
+	// Resource is the plural name of the resource, e.g. "pods".
+	Resource string
+	// Namespace is the namespace of the action, "" for all namespaces or
+	// resources that are not namespaced.
+	Namespace string
+	// Allowed is whether the action is expected to be allowed.
+	Allowed bool
+}
+
+// String describes the expected permission, e.g. "create pods in apps:
+// allowed".
+func (p Permission) String() string {
+	return fmt.Sprintf("%s: %s", p.action(), allowedString(p.Allowed))
+}
+
+// action describes the action of the permission, e.g. "create pods in apps".
+func (p Permission) action() string {
+	s := p.Verb + " " + p.Resource
+	if p.Group != "" {
+		s += "." + p.Group
+	}
+	if p.Namespace != "" {
+		s += " in " + p.Namespace
+	}
+	return s
+}
+
+func (p Permission) resourceAttributes() *authorizationv1.ResourceAttributes {
+	return &authorizationv1.ResourceAttributes{
+		Verb:      p.Verb,
+		Group:     p.Group,
+		Resource:  p.Resource,
+		Namespace: p.Namespace,
+	}
+}
+
+// RBACSubject is the Kubernetes user and groups that an IAM identity is mapped
+// to by the aws-auth ConfigMap, e.g. the username and groups of a roleMapping.
+type RBACSubject struct {
+	// User is the username of the subject. It may be empty to review the
+	// permissions of the groups alone.
+	User string
+	// Groups are the groups of the subject.
+	Groups []string
+}
+
+// String returns the user and groups of the subject.
+func (s RBACSubject) String() string {
+	if s.User == "" {
+		return fmt.Sprintf("groups [%s]", strings.Join(s.Groups, " "))
+	}
+	return fmt.Sprintf("user %s, groups [%s]", s.User, strings.Join(s.Groups, " "))
+}
+
+// groups returns the groups of the subject, and the group of all
+// authenticated users.
+func (s RBACSubject) groups() []string {
+	if containsString(s.Groups, authenticatedGroup) {
+		return s.Groups
+	}
+	return append(append([]string(nil), s.Groups...), authenticatedGroup)
+}
+
+// SubjectPermissions are the expected permissions of a subject.
+type SubjectPermissions struct {
+	Subject     RBACSubject
+	Permissions []Permission
+}
+
+// accessReview reviews whether an action is allowed.
+type accessReview func(attrs *authorizationv1.ResourceAttributes) (authorizationv1.SubjectAccessReviewStatus, error)
+
+// subjectAccessReview reviews the actions of subject with SubjectAccessReviews
+// created by clientset.
+func subjectAccessReview(clientset kubernetes.Interface, subject RBACSubject) accessReview {
+	return func(attrs *authorizationv1.ResourceAttributes) (authorizationv1.SubjectAccessReviewStatus, error) {
+		review, err := clientset.AuthorizationV1().SubjectAccessReviews().Create(&authorizationv1.SubjectAccessReview{
+			Spec: authorizationv1.SubjectAccessReviewSpec{
+				ResourceAttributes: attrs,
+				User:               subject.User,
+				Groups:             subject.groups(),
+			},
+		})
+		if err != nil {
+			return authorizationv1.SubjectAccessReviewStatus{}, err
+		}
+		return review.Status, nil
+	}
+}
+
+// selfSubjectAccessReview reviews the actions of the user of clientset with
+// SelfSubjectAccessReviews.
+func selfSubjectAccessReview(clientset kubernetes.Interface) accessReview {
+	return func(attrs *authorizationv1.ResourceAttributes) (authorizationv1.SubjectAccessReviewStatus, error) {
+		review, err := clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(
+			&authorizationv1.SelfSubjectAccessReview{
+				Spec: authorizationv1.SelfSubjectAccessReviewSpec{ResourceAttributes: attrs},
+			})
+		if err != nil {
+			return authorizationv1.SubjectAccessReviewStatus{}, err
+		}
+		return review.Status, nil
+	}
+}
+
+// verifyPermissions reviews each of the permissions, and returns an error
+// listing those that are not as expected. method names the kind of review in
+// errors.
+func verifyPermissions(method string, review accessReview, permissions []Permission) error {
+	var problems []string
+	for _, p := range permissions {
+		status, err := review(p.resourceAttributes())
+		if err != nil {
+			return fmt.Errorf("%s of %q: %w", method, p, err)
+		}
+		if status.Allowed == p.Allowed {
+			continue
+		}
+		problem := fmt.Sprintf("%s: expected %s, got %s", p.action(), allowedString(p.Allowed),
+			allowedString(status.Allowed))
+		if reason := joinNonEmpty(": ", status.Reason, status.EvaluationError); reason != "" {
+			problem += fmt.Sprintf(" (%s)", reason)
+		}
+		problems = append(problems, problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s: %s", method, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func allowedString(allowed bool) string {
+	if allowed {
+		return "allowed"
+	}
+	return "denied"
+}
+
+// VerifySubjectPermissions verifies that the permissions of subject are as
+// expected, using the admin access to the cluster. Each permission is
+// reviewed twice: with a SubjectAccessReview of the subject, and with a
+// SelfSubjectAccessReview made while impersonating the subject.
+func VerifySubjectPermissions(admin *KubeAccess, subject RBACSubject, permissions []Permission) error {
+	if err := verifyPermissions("SubjectAccessReview", subjectAccessReview(admin.Clientset, subject),
+		permissions); err != nil {
+		return fmt.Errorf("%s: %w", subject, err)
+	}
+
+	config := restclient.CopyConfig(admin.RESTConfig)
+	config.Impersonate = restclient.ImpersonationConfig{UserName: subject.User, Groups: subject.groups()}
+	if config.Impersonate.UserName == "" {
+		config.Impersonate.UserName = impersonatedGroupUser
+	}
+	impersonated, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	if err := verifyPermissions("impersonated SelfSubjectAccessReview", selfSubjectAccessReview(impersonated),
+		permissions); err != nil {
+		return fmt.Errorf("%s: %w", subject, err)
+	}
+	return nil
+}
+
+// VerifySelfPermissions verifies that the permissions of the user of
+// clientset, e.g. of a kubeconfig scoped to an IAM role, are as expected,
+// with SelfSubjectAccessReviews.
+func VerifySelfPermissions(clientset kubernetes.Interface, permissions []Permission) error {
+	return verifyPermissions("SelfSubjectAccessReview", selfSubjectAccessReview(clientset), permissions)
+}
+
+// PermissionsCheck ensures that the permissions of each subject are as
+// expected, as verified by VerifySubjectPermissions through the access to the
+// cluster under test. Reviews are retried, so that recently created RBAC
+// bindings have time to take effect.
+func PermissionsCheck(name string, expectations ...SubjectPermissions) Check {
+	return NewCheck(name, nil, func(ctx context.Context, env *CheckEnv) error {
+		for _, e := range expectations {
+			err := waitUntil(ctx, env.Logger, env.Options.newBackoff(), fmt.Sprintf("permissions of %s", e.Subject),
+				"as expected", func() (bool, error) {
+					err := VerifySubjectPermissions(env.KubeAccess, e.Subject, e.Permissions)
+					return err == nil, err
+				})
+			if err != nil {
+				return err
+			}
+			env.Logger.Logf("%d permissions of %s are as expected\n", len(e.Permissions), e.Subject)
+		}
+		return nil
+	})
+}
+
+// SelfPermissionsCheck ensures that the permissions of the user of the
+// cluster access under test are as expected, as verified by
+// VerifySelfPermissions. It is meant to be run through a scoped kubeconfig,
+// e.g. one that assumes an IAM role mapped to a limited group.
+func SelfPermissionsCheck(name string, permissions ...Permission) Check {
+	return NewCheck(name, nil, func(ctx context.Context, env *CheckEnv) error {
+		err := waitUntil(ctx, env.Logger, env.Options.newBackoff(), "permissions of the kubeconfig user",
+			"as expected", func() (bool, error) {
+				err := VerifySelfPermissions(env.KubeAccess.Clientset, permissions)
+				return err == nil, err
+			})
+		if err != nil {
+			return err
+		}
+		env.Logger.Logf("%d permissions of the kubeconfig user are as expected\n", len(permissions))
+		return nil
+	})
+}
@@ -0,0 +1,827 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+)
+
+// kindSource lists and watches all objects of a kind, across all namespaces.
+type kindSource struct {
+	list  func(c kubernetes.Interface, opts metav1.ListOptions) ([]runtime.Object, string, error)
+	watch func(c kubernetes.Interface, opts metav1.ListOptions) (watch.Interface, error)
+	// requires are the kinds that must also be followed to evaluate the
+	// readiness of this kind.
+	requires []string
+}
+
+// typedSource lists and watches all objects of a resource through the REST
+// client of its API group in the typed clientset, decoding lists as the
+// typed list returned by newList.
+func typedSource(client func(kubernetes.Interface) rest.Interface, resource string,
+	newList func() runtime.Object, requires ...string) kindSource {
+	return kindSource{
+		list: func(c kubernetes.Interface, opts metav1.ListOptions) ([]runtime.Object, string, error) {
+			l := newList()
+			err := client(c).Get().
+				Resource(resource).
+				VersionedParams(&opts, scheme.ParameterCodec).
+				Do().
+				Into(l)
+			if err != nil {
+				return nil, "", err
+			}
+			objs, err := meta.ExtractList(l)
+			if err != nil {
+				return nil, "", err
+			}
+			accessor, err := meta.ListAccessor(l)
+			if err != nil {
+				return nil, "", err
+			}
+			return objs, accessor.GetResourceVersion(), nil
+		},
+		watch: func(c kubernetes.Interface, opts metav1.ListOptions) (watch.Interface, error) {
+			opts.Watch = true
+			return client(c).Get().
+				Resource(resource).
+				VersionedParams(&opts, scheme.ParameterCodec).
+				Watch()
+		},
+		requires: requires,
+	}
+}
+
+func coreV1(c kubernetes.Interface) rest.Interface       { return c.CoreV1().RESTClient() }
+func appsV1(c kubernetes.Interface) rest.Interface       { return c.AppsV1().RESTClient() }
+func batchV1(c kubernetes.Interface) rest.Interface      { return c.BatchV1().RESTClient() }
+func batchV1beta1(c kubernetes.Interface) rest.Interface { return c.BatchV1beta1().RESTClient() }
+
+// trackableKinds maps the canonical name of each kind that a ReadinessTracker
+// can follow to its source.
+var trackableKinds = map[string]kindSource{
+	"Node":        typedSource(coreV1, "nodes", func() runtime.Object { return &corev1.NodeList{} }),
+	"Pod":         typedSource(coreV1, "pods", func() runtime.Object { return &corev1.PodList{} }),
+	"Deployment":  typedSource(appsV1, "deployments", func() runtime.Object { return &appsv1.DeploymentList{} }),
+	"ReplicaSet":  typedSource(appsV1, "replicasets", func() runtime.Object { return &appsv1.ReplicaSetList{} }),
+	"StatefulSet": typedSource(appsV1, "statefulsets", func() runtime.Object { return &appsv1.StatefulSetList{} }),
+	"Job":         typedSource(batchV1, "jobs", func() runtime.Object { return &batchv1.JobList{} }),
+	// DaemonSets are cross-checked against the Nodes they are eligible to
+	// run on.
+	"DaemonSet": typedSource(appsV1, "daemonsets", func() runtime.Object { return &appsv1.DaemonSetList{} },
+		"Node"),
+	// CronJobs are evaluated on the outcome of the last Job they scheduled.
+	"CronJob": typedSource(batchV1beta1, "cronjobs", func() runtime.Object { return &batchv1beta1.CronJobList{} },
+		"Job"),
+}
+
+// resolveKind returns the canonical kind name for a kind, its plural, or its
+// kubectl short name.
+func resolveKind(name string) (string, error) {
+	switch n := strings.ToLower(name); {
+	case n == "nodes" || n == "node" || n == "no":
+		return "Node", nil
+	case n == "deployments" || n == "deployment" || n == "deploy":
+		return "Deployment", nil
+	case n == "replicasets" || n == "replicaset" || n == "rs":
+		return "ReplicaSet", nil
+	case n == "pods" || n == "pod" || n == "po":
+		return "Pod", nil
+	case n == "daemonsets" || n == "daemonset" || n == "ds":
+		return "DaemonSet", nil
+	case n == "statefulsets" || n == "statefulset" || n == "sts":
+		return "StatefulSet", nil
+	case n == "jobs" || n == "job":
+		return "Job", nil
+	case n == "cronjobs" || n == "cronjob" || n == "cj":
+		return "CronJob", nil
+	}
+	return "", fmt.Errorf("unsupported kind %q", name)
+}
+
+// ObjectStatus is the readiness of a single Kubernetes object.
+type ObjectStatus struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Ready     bool   `json:"ready"`
+	// Reason describes why the object is not ready or, for ready objects,
+	// why they are considered ready despite their status, e.g. a terminal
+	// Pod that has been replaced.
+	Reason string `json:"reason,omitempty"`
+}
+
+// String returns the kind and namespaced name of the object.
+func (s ObjectStatus) String() string {
+	if s.Namespace == "" {
+		return fmt.Sprintf("%s %s", s.Kind, s.Name)
+	}
+	return fmt.Sprintf("%s %s/%s", s.Kind, s.Namespace, s.Name)
+}
+
+func (s ObjectStatus) key() string {
+	return fmt.Sprintf("%s/%s/%s", s.Kind, s.Namespace, s.Name)
+}
+
+// ReadinessStatus is a snapshot of the readiness of a set of objects.
+type ReadinessStatus struct {
+	Objects []ObjectStatus
+}
+
+// Count returns the number of objects of the given kind.
+func (s ReadinessStatus) Count(kind string) int {
+	var count int
+	for _, o := range s.Objects {
+		if o.Kind == kind {
+			count++
+		}
+	}
+	return count
+}
+
+// NotReady returns the objects that are not ready.
+func (s ReadinessStatus) NotReady() []ObjectStatus {
+	var notReady []ObjectStatus
+	for _, o := range s.Objects {
+		if !o.Ready {
+			notReady = append(notReady, o)
+		}
+	}
+	return notReady
+}
+
+// AllReady reports whether every object is ready.
+func (s ReadinessStatus) AllReady() bool {
+	return len(s.NotReady()) == 0
+}
+
+// NotReadyError is returned when a wait ends before all tracked objects are
+// ready.
+type NotReadyError struct {
+	// NotReady lists the objects that are still not ready.
+	NotReady []ObjectStatus
+	// Err is the reason the wait ended.
+	Err error
+}
+
+func (e *NotReadyError) Error() string {
+	objects := make([]string, len(e.NotReady))
+	for i, o := range e.NotReady {
+		objects[i] = o.String()
+		if o.Reason != "" {
+			objects[i] += fmt.Sprintf(" (%s)", o.Reason)
+		}
+	}
+	return fmt.Sprintf("%d objects are not ready: [%s]: %v", len(e.NotReady), strings.Join(objects, ", "), e.Err)
+}
+
+func (e *NotReadyError) Unwrap() error {
+	return e.Err
+}
+
+// ReadinessTracker follows the readiness of all objects of a set of kinds
+// through watches on the Kubernetes API Server, rather than polling each
+// object individually.
+//
+// A ReadinessTracker is single-use: its watches run for the duration of a
+// single call to WaitForReady.
+type ReadinessTracker struct {
+	// Logger, if set, receives periodic progress of the wait.
+	Logger Logger
+
+	// Filter scopes the tracked objects. It must be set before WaitForReady
+	// is called.
+	Filter ReadinessFilter
+
+	clientset kubernetes.Interface
+	sources   map[string]kindSource
+	rules     *ReadinessRules // rules of unstructured objects
+	kinds     []string        // kinds followed by watches
+	reported  map[string]bool // kinds reported in the status
+	expected  map[string]ObjectStatus
+	changed   chan struct{}
+
+	mu      sync.Mutex
+	objects map[string]map[string]runtime.Object // kind -> key -> object
+	lastErr error
+}
+
+// NewReadinessTracker creates a ReadinessTracker that follows all objects of
+// the given kinds, across all namespaces.
+func NewReadinessTracker(clientset kubernetes.Interface, kinds ...string) (*ReadinessTracker, error) {
+	if len(kinds) == 0 {
+		return nil, fmt.Errorf("no kinds to track")
+	}
+
+	r := newReadinessTracker(clientset)
+	for _, name := range kinds {
+		kind, err := resolveKind(name)
+		if err != nil {
+			return nil, err
+		}
+		r.reported[kind] = true
+		for _, kind := range append([]string{kind}, trackableKinds[kind].requires...) {
+			if _, ok := r.sources[kind]; !ok {
+				r.sources[kind] = trackableKinds[kind]
+				r.kinds = append(r.kinds, kind)
+			}
+		}
+	}
+	return r, nil
+}
+
+func newReadinessTracker(clientset kubernetes.Interface) *ReadinessTracker {
+	return &ReadinessTracker{
+		clientset: clientset,
+		sources:   make(map[string]kindSource),
+		reported:  make(map[string]bool),
+		expected:  make(map[string]ObjectStatus),
+		changed:   make(chan struct{}, 1),
+		objects:   make(map[string]map[string]runtime.Object),
+	}
+}
+
+// Expect restricts the tracked set to the given object, rather than all
+// objects of its kind. Expected objects that do not exist are not ready.
+func (r *ReadinessTracker) Expect(kind, namespace, name string) {
+	o := ObjectStatus{Kind: kind, Namespace: namespace, Name: name}
+	r.expected[o.key()] = o
+}
+
+// Status returns the readiness of the tracked objects last seen by the
+// watches.
+func (r *ReadinessTracker) Status() ReadinessStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var nodes []*corev1.Node
+	for _, obj := range r.objects["Node"] {
+		nodes = append(nodes, obj.(*corev1.Node))
+	}
+	var jobs []*batchv1.Job
+	for _, obj := range r.objects["Job"] {
+		jobs = append(jobs, obj.(*batchv1.Job))
+	}
+	var pods []*corev1.Pod
+	for _, obj := range r.objects["Pod"] {
+		pods = append(pods, obj.(*corev1.Pod))
+	}
+
+	var status ReadinessStatus
+	seen := make(map[string]bool)
+	for kind, objects := range r.objects {
+		if !r.reported[kind] {
+			continue
+		}
+		for _, obj := range objects {
+			var o ObjectStatus
+			if u, ok := obj.(*unstructured.Unstructured); ok {
+				o = r.rules.Evaluate(u)
+			} else if o, ok = objectReadiness(obj); !ok {
+				continue
+			}
+			switch obj := obj.(type) {
+			case *appsv1.DaemonSet:
+				if o.Ready {
+					o.Ready, o.Reason = DaemonSetNodeReadiness(obj, nodes)
+				}
+			case *batchv1beta1.CronJob:
+				o.Ready, o.Reason = CronJobReadiness(obj, jobs)
+			}
+
+			// Terminal Pods that have been replaced by a ready Pod are not a
+			// failure of their controller, unless the policy says otherwise.
+			var ignored bool
+			if pod, ok := obj.(*corev1.Pod); ok && !o.Ready && r.Filter.terminalPodPolicy() != TerminalPodsFail {
+				if replacement := TerminalPodReplacement(pod, pods); replacement != nil {
+					if ready, _ := PodReadiness(replacement); ready {
+						o.Ready = true
+						o.Reason = fmt.Sprintf("%s; replaced by Pod %s", o.Reason, replacement.Name)
+						ignored = r.Filter.terminalPodPolicy() == TerminalPodsIgnore
+					} else {
+						o.Reason = fmt.Sprintf("%s; replaced by Pod %s, which is not ready", o.Reason, replacement.Name)
+					}
+				}
+			}
+
+			if len(r.expected) > 0 {
+				if _, ok := r.expected[o.key()]; !ok {
+					continue
+				}
+			} else if !r.Filter.includes(o) {
+				continue
+			}
+			seen[o.key()] = true
+			if !ignored {
+				status.Objects = append(status.Objects, o)
+			}
+		}
+	}
+	for key, o := range r.expected {
+		if !seen[key] {
+			o.Reason = "not found"
+			status.Objects = append(status.Objects, o)
+		}
+	}
+
+	sort.Slice(status.Objects, func(i, j int) bool {
+		return status.Objects[i].key() < status.Objects[j].key()
+	})
+	return status
+}
+
+// trackedObjects returns the objects of a kind last seen by the watches,
+// whether or not they pass the filter.
+func (r *ReadinessTracker) trackedObjects(kind string) []runtime.Object {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	objs := make([]runtime.Object, 0, len(r.objects[kind]))
+	for _, obj := range r.objects[kind] {
+		objs = append(objs, obj)
+	}
+	return objs
+}
+
+// WaitForReady starts the watches, and waits until done reports that the
+// tracked objects are ready, or until ctx is done. A nil done waits for all
+// tracked objects to be ready.
+//
+// If ctx is done first, the returned error is a *NotReadyError listing the
+// objects that are still not ready.
+func (r *ReadinessTracker) WaitForReady(ctx context.Context, done func(ReadinessStatus) bool) (ReadinessStatus, error) {
+	if done == nil {
+		done = ReadinessStatus.AllReady
+	}
+	if err := r.Filter.validate(); err != nil {
+		return ReadinessStatus{}, err
+	}
+
+	// Stop the watches before returning.
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+	for _, kind := range r.kinds {
+		wg.Add(1)
+		go func(kind string) {
+			defer wg.Done()
+			r.follow(ctx, kind)
+		}(kind)
+	}
+
+	progress := time.NewTicker(RetryInterval * time.Second)
+	defer progress.Stop()
+	for {
+		var status ReadinessStatus
+		if r.synced() {
+			status = r.Status()
+			if done(status) {
+				return status, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if !r.synced() {
+				return status, fmt.Errorf("could not list all of %v: %v: %w", r.kinds, r.err(), ctx.Err())
+			}
+			status = r.diagnose(status)
+			return status, &NotReadyError{NotReady: status.NotReady(), Err: ctx.Err()}
+		case <-progress.C:
+			if r.Logger != nil {
+				notReady := status.NotReady()
+				r.Logger.Logf("Waiting on %d out of %d objects to be ready...\n", len(notReady), len(status.Objects))
+			}
+		case <-r.changed:
+		}
+	}
+}
+
+// maxDiagnosedPods bounds the number of not ready Pods whose events are listed
+// when a wait ends.
+const maxDiagnosedPods = 20
+
+// diagnose refines the reasons of not ready Pods with their events, so that
+// failures can be triaged without access to the cluster.
+func (r *ReadinessTracker) diagnose(status ReadinessStatus) ReadinessStatus {
+	if r.clientset == nil {
+		return status
+	}
+	var diagnosed int
+	for i, o := range status.Objects {
+		if o.Kind != "Pod" || o.Ready || diagnosed == maxDiagnosedPods {
+			continue
+		}
+		r.mu.Lock()
+		obj, ok := r.objects["Pod"][o.Namespace+"/"+o.Name]
+		r.mu.Unlock()
+		if !ok {
+			continue
+		}
+		pod := obj.(*corev1.Pod)
+		events, err := PodEvents(r.clientset, pod)
+		if err != nil {
+			continue
+		}
+		diagnosed++
+		status.Objects[i].Reason = DiagnosePod(pod, events).String()
+	}
+	return status
+}
+
+// follow lists all objects of a kind, and then watches them for changes,
+// relisting whenever the watch ends, until ctx is done.
+func (r *ReadinessTracker) follow(ctx context.Context, kind string) {
+	source := r.sources[kind]
+
+	// Kinds that are only followed to evaluate other kinds, e.g. the Nodes of
+	// DaemonSets, are not filtered.
+	var opts metav1.ListOptions
+	if r.reported[kind] {
+		opts = r.Filter.listOptions(kind)
+	}
+
+	b := &backoff{interval: time.Second, max: RetryInterval * time.Second, factor: 2}
+	for ctx.Err() == nil {
+		objs, resourceVersion, err := source.list(r.clientset, opts)
+		if err != nil {
+			r.setErr(err)
+			sleepWithContext(ctx, b.next())
+			continue
+		}
+		r.replace(kind, objs)
+
+		watchOpts := opts
+		watchOpts.ResourceVersion = resourceVersion
+		w, err := source.watch(r.clientset, watchOpts)
+		if err != nil {
+			r.setErr(err)
+			sleepWithContext(ctx, b.next())
+			continue
+		}
+		r.watch(ctx, kind, w)
+	}
+}
+
+// watch applies the events of w to the tracked objects of a kind, until the
+// watch ends or ctx is done.
+func (r *ReadinessTracker) watch(ctx context.Context, kind string, w watch.Interface) {
+	defer w.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				return
+			}
+			switch event.Type {
+			case watch.Added, watch.Modified:
+				r.update(kind, event.Object, false)
+			case watch.Deleted:
+				r.update(kind, event.Object, true)
+			case watch.Error:
+				r.setErr(apierrors.FromObject(event.Object))
+				return
+			}
+		}
+	}
+}
+
+// replace sets the tracked objects of a kind to the result of a list. The
+// objects are swapped in at once, so that a wait never evaluates a partial
+// list.
+func (r *ReadinessTracker) replace(kind string, objs []runtime.Object) {
+	objects := make(map[string]runtime.Object, len(objs))
+	for _, obj := range objs {
+		if key, ok := objectKey(obj); ok {
+			objects[key] = obj
+		}
+	}
+
+	r.mu.Lock()
+	r.objects[kind] = objects
+	r.mu.Unlock()
+	r.notify()
+}
+
+// update adds, modifies or deletes a tracked object of a kind.
+func (r *ReadinessTracker) update(kind string, obj runtime.Object, deleted bool) {
+	key, ok := objectKey(obj)
+	if !ok {
+		return
+	}
+
+	r.mu.Lock()
+	if deleted {
+		delete(r.objects[kind], key)
+	} else {
+		r.objects[kind][key] = obj
+	}
+	r.mu.Unlock()
+	r.notify()
+}
+
+// objectKey returns the namespaced name that an object is tracked under.
+func objectKey(obj runtime.Object) (string, bool) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return "", false
+	}
+	return accessor.GetNamespace() + "/" + accessor.GetName(), true
+}
+
+// synced reports whether every kind has been listed at least once.
+func (r *ReadinessTracker) synced() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.objects) == len(r.kinds)
+}
+
+func (r *ReadinessTracker) notify() {
+	select {
+	case r.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (r *ReadinessTracker) setErr(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastErr = err
+}
+
+func (r *ReadinessTracker) err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastErr
+}
+
+// objectReadiness evaluates the readiness of an object of a trackable kind.
+func objectReadiness(obj interface{}) (ObjectStatus, bool) {
+	var o ObjectStatus
+	switch obj := obj.(type) {
+	case *corev1.Node:
+		o = ObjectStatus{Kind: "Node", Name: obj.Name}
+		o.Ready, o.Reason = NodeReadiness(obj)
+	case *corev1.Pod:
+		o = ObjectStatus{Kind: "Pod", Namespace: obj.Namespace, Name: obj.Name}
+		o.Ready, o.Reason = PodReadiness(obj)
+	case *appsv1.Deployment:
+		o = ObjectStatus{Kind: "Deployment", Namespace: obj.Namespace, Name: obj.Name}
+		o.Ready, o.Reason = DeploymentReadiness(obj)
+	case *appsv1.ReplicaSet:
+		o = ObjectStatus{Kind: "ReplicaSet", Namespace: obj.Namespace, Name: obj.Name}
+		o.Ready, o.Reason = ReplicaSetReadiness(obj)
+	case *appsv1.DaemonSet:
+		o = ObjectStatus{Kind: "DaemonSet", Namespace: obj.Namespace, Name: obj.Name}
+		o.Ready, o.Reason = DaemonSetReadiness(obj)
+	case *appsv1.StatefulSet:
+		o = ObjectStatus{Kind: "StatefulSet", Namespace: obj.Namespace, Name: obj.Name}
+		o.Ready, o.Reason = StatefulSetReadiness(obj)
+	case *batchv1.Job:
+		o = ObjectStatus{Kind: "Job", Namespace: obj.Namespace, Name: obj.Name}
+		o.Ready, o.Reason = JobReadiness(obj)
+	case *batchv1beta1.CronJob:
+		o = ObjectStatus{Kind: "CronJob", Namespace: obj.Namespace, Name: obj.Name}
+		o.Ready, o.Reason = CronJobReadiness(obj, nil)
+	default:
+		return o, false
+	}
+	return o, true
+}
+
+// NodeReadiness checks if the Node status condition is ready.
+func NodeReadiness(node *corev1.Node) (bool, string) {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			if condition.Status == corev1.ConditionTrue {
+				return true, ""
+			}
+			return false, fmt.Sprintf("condition Ready is %s: %s", condition.Status, condition.Message)
+		}
+	}
+	return false, "condition Ready is not reported"
+}
+
+// PodReadiness checks if the Pod's status & condition is ready. Pods that
+// have run to completion are considered ready. Pods that are not ready are
+// reported with their DiagnosePod classification.
+func PodReadiness(pod *corev1.Pod) (bool, string) {
+	switch pod.Status.Phase {
+	case corev1.PodSucceeded:
+		return true, ""
+	case corev1.PodRunning:
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == corev1.PodReady && condition.Status == corev1.ConditionTrue {
+				return true, ""
+			}
+		}
+	}
+	return false, DiagnosePod(pod, nil).String()
+}
+
+// DeploymentReadiness checks if the Deployment's status conditions are ready.
+func DeploymentReadiness(deployment *appsv1.Deployment) (bool, string) {
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == appsv1.DeploymentAvailable {
+			if condition.Status == corev1.ConditionTrue {
+				return true, ""
+			}
+			return false, fmt.Sprintf("condition Available is %s: %s", condition.Status, condition.Message)
+		}
+	}
+	return false, "condition Available is not reported"
+}
+
+// ReplicaSetReadiness checks if the ReplicaSet's replicas are all available
+// and ready.
+func ReplicaSetReadiness(replicaSet *appsv1.ReplicaSet) (bool, string) {
+	for _, condition := range replicaSet.Status.Conditions {
+		if condition.Type == appsv1.ReplicaSetReplicaFailure {
+			return false, fmt.Sprintf("replica failure: %s", condition.Message)
+		}
+	}
+	s := replicaSet.Status
+	if s.Replicas == s.AvailableReplicas && s.Replicas == s.ReadyReplicas {
+		return true, ""
+	}
+	return false, fmt.Sprintf("%d/%d replicas ready, %d/%d available",
+		s.ReadyReplicas, s.Replicas, s.AvailableReplicas, s.Replicas)
+}
+
+// DaemonSetReadiness checks if the DaemonSet's Pods are scheduled, updated and
+// ready on every Node it desires to run on.
+func DaemonSetReadiness(daemonSet *appsv1.DaemonSet) (bool, string) {
+	s := daemonSet.Status
+	if s.ObservedGeneration < daemonSet.Generation {
+		return false, "spec update has not been observed"
+	}
+	if s.DesiredNumberScheduled == s.NumberReady && s.DesiredNumberScheduled == s.UpdatedNumberScheduled {
+		return true, ""
+	}
+	return false, fmt.Sprintf("%d/%d Pods ready, %d/%d updated",
+		s.NumberReady, s.DesiredNumberScheduled, s.UpdatedNumberScheduled, s.DesiredNumberScheduled)
+}
+
+// StatefulSetReadiness checks if the StatefulSet's replicas are all ready, and
+// have been updated to its current revision.
+func StatefulSetReadiness(statefulSet *appsv1.StatefulSet) (bool, string) {
+	s := statefulSet.Status
+	if s.ObservedGeneration < statefulSet.Generation {
+		return false, "spec update has not been observed"
+	}
+	replicas := int32(1)
+	if statefulSet.Spec.Replicas != nil {
+		replicas = *statefulSet.Spec.Replicas
+	}
+	if s.ReadyReplicas != replicas {
+		return false, fmt.Sprintf("%d/%d replicas ready", s.ReadyReplicas, replicas)
+	}
+
+	// Pods are only updated to a new revision by the RollingUpdate strategy,
+	// and only at or above the partition ordinal.
+	strategy := statefulSet.Spec.UpdateStrategy
+	if strategy.Type == appsv1.OnDeleteStatefulSetStrategyType {
+		return true, ""
+	}
+	if strategy.RollingUpdate != nil && strategy.RollingUpdate.Partition != nil {
+		if updated := replicas - *strategy.RollingUpdate.Partition; s.UpdatedReplicas < updated {
+			return false, fmt.Sprintf("%d/%d replicas updated to revision %s", s.UpdatedReplicas, updated, s.UpdateRevision)
+		}
+		return true, ""
+	}
+	if s.UpdateRevision != s.CurrentRevision || s.CurrentReplicas != replicas {
+		return false, fmt.Sprintf("%d/%d replicas updated to revision %s",
+			s.UpdatedReplicas, replicas, s.UpdateRevision)
+	}
+	return true, ""
+}
+
+// JobReadiness checks if the Job has completed. A Job that has failed, e.g.
+// by exceeding its backoff limit or deadline, is reported with the reason it
+// failed.
+func JobReadiness(job *batchv1.Job) (bool, string) {
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch condition.Type {
+		case batchv1.JobComplete:
+			return true, ""
+		case batchv1.JobFailed:
+			return false, fmt.Sprintf("failed: %s: %s", condition.Reason, condition.Message)
+		}
+	}
+	s := job.Status
+	if job.Spec.Completions == nil {
+		return false, fmt.Sprintf("not complete, %d active, %d failed", s.Active, s.Failed)
+	}
+	return false, fmt.Sprintf("%d/%d completions, %d active, %d failed",
+		s.Succeeded, *job.Spec.Completions, s.Active, s.Failed)
+}
+
+// cronJobScheduleGrace is how late a CronJob may schedule a Job before the
+// scheduled time is considered missed, unless its starting deadline is later.
+const cronJobScheduleGrace = time.Minute
+
+// CronJobReadiness checks if the CronJob has not missed a scheduled time since
+// it was last scheduled, e.g. because its starting deadline is shorter than
+// the delay of the controller, and if the last Job it scheduled, among jobs,
+// has not failed. Suspended CronJobs are considered ready, with "suspended" as
+// the reason.
+func CronJobReadiness(cronJob *batchv1beta1.CronJob, jobs []*batchv1.Job) (bool, string) {
+	return cronJobReadiness(cronJob, jobs, time.Now())
+}
+
+func cronJobReadiness(cronJob *batchv1beta1.CronJob, jobs []*batchv1.Job, now time.Time) (bool, string) {
+	if cronJob.Spec.Suspend != nil && *cronJob.Spec.Suspend {
+		return true, "suspended"
+	}
+	if ready, reason := cronJobScheduleReadiness(cronJob, now); !ready {
+		return false, reason
+	}
+
+	var last *batchv1.Job
+	for _, job := range jobs {
+		if job.Namespace != cronJob.Namespace || !isOwnedBy(job, cronJob) {
+			continue
+		}
+		if last == nil || last.CreationTimestamp.Before(&job.CreationTimestamp) {
+			last = job
+		}
+	}
+	if last == nil {
+		return true, ""
+	}
+	for _, condition := range last.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+			return false, fmt.Sprintf("last Job %s failed: %s: %s", last.Name, condition.Reason, condition.Message)
+		}
+	}
+	return true, ""
+}
+
+// cronJobScheduleReadiness checks if the CronJob has scheduled a Job for every
+// time of its schedule since it was last scheduled, or created. Schedules are
+// evaluated in UTC, like the CronJob controller of EKS.
+func cronJobScheduleReadiness(cronJob *batchv1beta1.CronJob, now time.Time) (bool, string) {
+	schedule, err := parseCronSchedule(cronJob.Spec.Schedule)
+	if err != nil {
+		return false, fmt.Sprintf("invalid schedule: %v", err)
+	}
+
+	grace := cronJobScheduleGrace
+	deadline := cronJob.Spec.StartingDeadlineSeconds
+	if deadline != nil && time.Duration(*deadline)*time.Second > grace {
+		grace = time.Duration(*deadline) * time.Second
+	}
+	since := cronJob.CreationTimestamp.Time
+	if cronJob.Status.LastScheduleTime != nil {
+		since = cronJob.Status.LastScheduleTime.Time
+	}
+	missed := schedule.next(since.UTC())
+	if missed.IsZero() || !missed.Add(grace).Before(now) {
+		return true, ""
+	}
+
+	reason := fmt.Sprintf("missed schedule at %s", missed.Format(time.RFC3339))
+	if cronJob.Status.LastScheduleTime != nil {
+		reason += fmt.Sprintf(", last scheduled at %s", since.UTC().Format(time.RFC3339))
+	} else {
+		reason += ", never scheduled"
+	}
+	if deadline != nil {
+		reason += fmt.Sprintf(", startingDeadlineSeconds is %d", *deadline)
+	}
+	return false, reason
+}
+
+// isOwnedBy reports whether obj has an owner reference to owner.
+func isOwnedBy(obj, owner metav1.Object) bool {
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.UID == owner.GetUID() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,205 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// blockingDeployment is a Deployment whose name cannot be read until it is
+// released, to pause a ReadinessTracker while it stores a list.
+type blockingDeployment struct {
+	*appsv1.Deployment
+	read    chan struct{}
+	release chan struct{}
+}
+
+func (d *blockingDeployment) GetName() string {
+	close(d.read)
+	<-d.release
+	return d.Deployment.GetName()
+}
+
+func TestReadinessTrackerWaitsForWholeList(t *testing.T) {
+	blocking := &blockingDeployment{
+		Deployment: &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "deployment-1"}},
+		read:       make(chan struct{}),
+		release:    make(chan struct{}),
+	}
+	ready := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "deployment-0"},
+		Status: appsv1.DeploymentStatus{Conditions: []appsv1.DeploymentCondition{
+			{Type: appsv1.DeploymentAvailable, Status: corev1.ConditionTrue},
+		}},
+	}
+	notReady := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "deployment-2"}}
+
+	r := newReadinessTracker(nil)
+	r.sources["Deployment"] = kindSource{
+		list: func(kubernetes.Interface, metav1.ListOptions) ([]runtime.Object, string, error) {
+			return []runtime.Object{ready, blocking, notReady}, "1", nil
+		},
+		watch: func(kubernetes.Interface, metav1.ListOptions) (watch.Interface, error) {
+			return watch.NewFake(), nil
+		},
+	}
+	r.kinds = []string{"Deployment"}
+	r.reported["Deployment"] = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	type result struct {
+		status ReadinessStatus
+		err    error
+	}
+	results := make(chan result, 1)
+	go func() {
+		status, err := r.WaitForReady(ctx, nil)
+		results <- result{status, err}
+	}()
+
+	// While the list is being stored, the wait must not evaluate the part of
+	// it that is ready.
+	<-blocking.read
+	select {
+	case res := <-results:
+		t.Fatalf("wait finished on a partial list: %+v, %v", res.status, res.err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(blocking.release)
+
+	res := <-results
+	var notReadyErr *NotReadyError
+	require.True(t, errors.As(res.err, &notReadyErr), "%v", res.err)
+	assert.Equal(t, []ObjectStatus{
+		{Kind: "Deployment", Namespace: "default", Name: "deployment-2", Reason: "condition Available is not reported"},
+	}, notReadyErr.NotReady)
+}
+
+func TestTypedSourceList(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/apis/apps/v1/daemonsets", r.URL.Path)
+		assert.Equal(t, "app=web", r.URL.Query().Get("labelSelector"))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"kind":"DaemonSetList","apiVersion":"apps/v1","metadata":{"resourceVersion":"42"},`+
+			`"items":[{"metadata":{"namespace":"kube-system","name":"aws-node"}}]}`)
+	}))
+	defer server.Close()
+	clientset, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	require.NoError(t, err)
+
+	source := trackableKinds["DaemonSet"]
+	assert.Equal(t, []string{"Node"}, source.requires)
+	objs, resourceVersion, err := source.list(clientset, metav1.ListOptions{LabelSelector: "app=web"})
+	require.NoError(t, err)
+	assert.Equal(t, "42", resourceVersion)
+	require.Len(t, objs, 1)
+	daemonSet, ok := objs[0].(*appsv1.DaemonSet)
+	require.True(t, ok, "%T", objs[0])
+	assert.Equal(t, "aws-node", daemonSet.Name)
+}
+
+func TestCronJobReadiness(t *testing.T) {
+	now := time.Date(2020, time.May, 1, 10, 7, 0, 0, time.UTC)
+	at := func(d time.Duration) *metav1.Time {
+		t := metav1.NewTime(now.Add(d))
+		return &t
+	}
+	int64Ptr := func(i int64) *int64 { return &i }
+	suspend := true
+
+	newCronJob := func(schedule string, lastSchedule *metav1.Time, deadline *int64) *batchv1beta1.CronJob {
+		return &batchv1beta1.CronJob{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:         "default",
+				Name:              "backup",
+				UID:               types.UID("backup-uid"),
+				CreationTimestamp: *at(-24 * time.Hour),
+			},
+			Spec:   batchv1beta1.CronJobSpec{Schedule: schedule, StartingDeadlineSeconds: deadline},
+			Status: batchv1beta1.CronJobStatus{LastScheduleTime: lastSchedule},
+		}
+	}
+	failedJob := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "default",
+			Name:            "backup-1588327200",
+			OwnerReferences: []metav1.OwnerReference{{UID: types.UID("backup-uid")}},
+		},
+		Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+			{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Reason: "BackoffLimitExceeded", Message: "too many retries"},
+		}},
+	}
+
+	for name, tc := range map[string]struct {
+		cronJob *batchv1beta1.CronJob
+		jobs    []*batchv1.Job
+		ready   bool
+		reason  string
+	}{
+		"on schedule": {
+			cronJob: newCronJob("*/5 * * * *", at(-2*time.Minute), nil),
+			ready:   true,
+		},
+		"within the grace period": {
+			cronJob: newCronJob("6 * * * *", at(-61*time.Minute), nil),
+			ready:   true,
+		},
+		"within the starting deadline": {
+			cronJob: newCronJob("*/5 * * * *", at(-12*time.Minute), int64Ptr(600)),
+			ready:   true,
+		},
+		"missed schedules": {
+			cronJob: newCronJob("*/5 * * * *", at(-37*time.Minute), int64Ptr(5)),
+			reason: "missed schedule at 2020-05-01T09:35:00Z, last scheduled at 2020-05-01T09:30:00Z, " +
+				"startingDeadlineSeconds is 5",
+		},
+		"never scheduled": {
+			cronJob: newCronJob("0 * * * *", nil, nil),
+			reason:  "missed schedule at 2020-04-30T11:00:00Z, never scheduled",
+		},
+		"not yet due": {
+			cronJob: newCronJob("@yearly", nil, nil),
+			ready:   true,
+		},
+		"suspended": {
+			cronJob: func() *batchv1beta1.CronJob {
+				c := newCronJob("*/5 * * * *", at(-37*time.Minute), nil)
+				c.Spec.Suspend = &suspend
+				return c
+			}(),
+			ready:  true,
+			reason: "suspended",
+		},
+		"invalid schedule": {
+			cronJob: newCronJob("*/5 * * *", nil, nil),
+			reason:  `invalid schedule: expected 5 fields, found 4: "*/5 * * *"`,
+		},
+		"last Job failed": {
+			cronJob: newCronJob("*/5 * * * *", at(-2*time.Minute), nil),
+			jobs:    []*batchv1.Job{failedJob},
+			reason:  "last Job backup-1588327200 failed: BackoffLimitExceeded: too many retries",
+		},
+	} {
+		ready, reason := cronJobReadiness(tc.cronJob, tc.jobs, now)
+		assert.Equal(t, tc.ready, ready, name)
+		assert.Equal(t, tc.reason, reason, name)
+	}
+}
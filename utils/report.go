@@ -0,0 +1,203 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// SmokeTestReportEnvVar is the environment variable naming where to write the
+// JSON report of each smoke test run.
+//
+// If it names an existing directory, or ends in a path separator, a report
+// named after the test is written into that directory, so that tests run in
+// parallel do not overwrite each other's reports. Otherwise, it names the
+// report file.
+const SmokeTestReportEnvVar = "EKS_SMOKE_TEST_REPORT"
+
+// SmokeTestReport is the machine-readable result of a smoke test run.
+type SmokeTestReport struct {
+	// Test is the name of the Go test that ran the smoke test, if any.
+	Test      string          `json:"test,omitempty"`
+	StartTime time.Time       `json:"startTime"`
+	Clusters  []ClusterReport `json:"clusters"`
+	// Errors are failures that are not attributed to a single cluster, e.g.
+	// an invalid kubeconfig.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// ClusterReport is the result of the smoke test of a single cluster.
+type ClusterReport struct {
+	Name             string        `json:"name"`
+	ServerVersion    string        `json:"serverVersion,omitempty"`
+	ServerGitVersion string        `json:"serverGitVersion,omitempty"`
+	DesiredNodeCount int           `json:"desiredNodeCount"`
+	NodeGroups       []NodeGroup   `json:"nodeGroups,omitempty"`
+	Checks           []CheckResult `json:"checks"`
+	// Error is a failure of the cluster that prevented checks from running.
+	Error string `json:"error,omitempty"`
+}
+
+// Passed reports whether every cluster passed all of its checks.
+func (r *SmokeTestReport) Passed() bool {
+	if len(r.Errors) > 0 {
+		return false
+	}
+	for _, cluster := range r.Clusters {
+		if !cluster.Passed() {
+			return false
+		}
+	}
+	return true
+}
+
+// Passed reports whether the cluster passed all of its checks. Skipped
+// checks do not fail the cluster.
+func (r *ClusterReport) Passed() bool {
+	if r.Error != "" {
+		return false
+	}
+	for _, check := range r.Checks {
+		if check.Status == CheckFailed {
+			return false
+		}
+	}
+	return true
+}
+
+// Err summarizes why the smoke test failed, or returns nil if it passed.
+func (r *SmokeTestReport) Err() error {
+	if r.Passed() {
+		return nil
+	}
+	var failures []string
+	failures = append(failures, r.Errors...)
+	for _, cluster := range r.Clusters {
+		if cluster.Error != "" {
+			failures = append(failures, fmt.Sprintf("cluster %q: %s", cluster.Name, cluster.Error))
+		}
+		for _, check := range cluster.Checks {
+			if check.Status == CheckFailed {
+				failures = append(failures, fmt.Sprintf("cluster %q: check %q failed: %v",
+					cluster.Name, check.Name, check.Err))
+			}
+		}
+	}
+	return fmt.Errorf("smoke test failed:\n\t%s", strings.Join(failures, "\n\t"))
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *SmokeTestReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteText writes a human-readable summary of the report, with one line per
+// check of each cluster.
+func (r *SmokeTestReport) WriteText(w io.Writer) error {
+	var b strings.Builder
+	for _, err := range r.Errors {
+		fmt.Fprintf(&b, "ERROR: %s\n", err)
+	}
+	for _, cluster := range r.Clusters {
+		status := "PASS"
+		if !cluster.Passed() {
+			status = "FAIL"
+		}
+		fmt.Fprintf(&b, "%s %s", status, cluster.Name)
+		if cluster.ServerGitVersion != "" {
+			fmt.Fprintf(&b, " (%s)", cluster.ServerGitVersion)
+		}
+		b.WriteString("\n")
+		if cluster.Error != "" {
+			fmt.Fprintf(&b, "    error: %s\n", cluster.Error)
+		}
+		for _, check := range cluster.Checks {
+			fmt.Fprintf(&b, "    %-8s %-12s %v\n", check.Status, check.Name, check.Duration.Round(time.Millisecond))
+			if check.Err != nil {
+				fmt.Fprintf(&b, "             %v\n", check.Err)
+			} else if check.Message != "" {
+				fmt.Fprintf(&b, "             %s\n", check.Message)
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteJSONFile writes the report as indented JSON to the file at path.
+func (r *SmokeTestReport) WriteJSONFile(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := r.WriteJSON(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// MarshalJSON encodes the result with its error as a string, and its
+// duration in seconds.
+func (r CheckResult) MarshalJSON() ([]byte, error) {
+	result := struct {
+		Name            string         `json:"name"`
+		Status          CheckStatus    `json:"status"`
+		DurationSeconds float64        `json:"durationSeconds"`
+		Error           string         `json:"error,omitempty"`
+		Message         string         `json:"message,omitempty"`
+		Objects         []ObjectStatus `json:"objects,omitempty"`
+	}{
+		Name:            r.Name,
+		Status:          r.Status,
+		DurationSeconds: r.Duration.Seconds(),
+		Message:         r.Message,
+		Objects:         r.Objects,
+	}
+	if r.Err != nil {
+		result.Error = r.Err.Error()
+	}
+	return json.Marshal(result)
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// reportPath returns the file the report of the named test should be written
+// to, based on the environment variable envVar, or "" if no report is
+// requested. ext is the file extension of reports written into a directory.
+func reportPath(envVar, test, ext string) string {
+	path := os.Getenv(envVar)
+	if path == "" {
+		return ""
+	}
+	if info, err := os.Stat(path); (err == nil && info.IsDir()) || os.IsPathSeparator(path[len(path)-1]) {
+		return filepath.Join(path, unsafeFileChars.ReplaceAllString(test, "_")+ext)
+	}
+	return path
+}
+
+// writeReportFiles writes the report to the locations requested by
+// SmokeTestReportEnvVar and SmokeTestJUnitEnvVar.
+func (r *SmokeTestReport) writeReportFiles() error {
+	if path := reportPath(SmokeTestReportEnvVar, r.Test, ".json"); path != "" {
+		if err := r.WriteJSONFile(path); err != nil {
+			return err
+		}
+	}
+	if path := reportPath(SmokeTestJUnitEnvVar, r.Test, ".xml"); path != "" {
+		if err := r.WriteJUnitFile(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pulumi/pulumi/sdk/v2/go/common/apitype"
+)
+
+// RunSmokeTest runs the EKS Smoke Test outside of a Go test, e.g. from a CLI,
+// logging the progress of each cluster to opts.Logger.
+//
+// It returns a report of the checks of each cluster, which is also written to
+// the locations set in SmokeTestReportEnvVar and SmokeTestJUnitEnvVar, if any.
+// The returned error is non-nil if any cluster failed the smoke test.
+func RunSmokeTest(opts SmokeTestOptions, resources []apitype.ResourceV3,
+	kubeconfigs ...interface{}) (*SmokeTestReport, error) {
+	opts = opts.withDefaults()
+
+	report := runSmokeTest(opts, resources, kubeconfigs,
+		func(clusterName string, test func(Logger) ClusterReport) ClusterReport {
+			return test(&prefixLogger{prefix: fmt.Sprintf("[%s] ", clusterName), logger: opts.Logger})
+		})
+
+	if err := report.writeReportFiles(); err != nil {
+		return report, fmt.Errorf("failed to write smoke test report: %w", err)
+	}
+	return report, report.Err()
+}
+
+// runSmokeTest runs the smoke test against each cluster, up to
+// opts.Parallelism at once. runCluster is called from the goroutine of each
+// cluster, and must call test with the Logger the cluster's progress is
+// written to.
+func runSmokeTest(opts SmokeTestOptions, resources []apitype.ResourceV3, kubeconfigs []interface{},
+	runCluster func(clusterName string, test func(Logger) ClusterReport) ClusterReport) *SmokeTestReport {
+	report := &SmokeTestReport{StartTime: time.Now()}
+
+	// Map the cluster name to its NodeGroups, and to their total desired
+	// Node count.
+	clusterNodeGroups, err := mapClusterToNodeGroups(resources)
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	}
+	clusterNodeCount := totalNodeCounts(clusterNodeGroups)
+
+	// Attribute Nodes to their self-managed node group by the Auto Scaling
+	// group of their instance, in the region of the stack.
+	if opts.AutoScaling == nil {
+		if region := stackAWSRegion(resources); region != "" {
+			if client, err := NewAutoScalingClient(region); err != nil {
+				report.Errors = append(report.Errors, err.Error())
+			} else {
+				opts.AutoScaling = client
+			}
+		}
+	}
+
+	// Map the cluster name to the IAM roles of its worker Nodes.
+	clusterNodeRoles, err := mapClusterToNodeRoles(resources)
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	}
+
+	// Map the cluster name to the KubeAccess client-go tool bag.
+	kubeAccess, err := mapClusterToKubeAccess(resources, kubeconfigs...)
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	}
+
+	// Run the smoke test against each cluster, expecting the total desired
+	// Node count.
+	clusterNames := make([]string, 0, len(kubeAccess))
+	for clusterName := range kubeAccess {
+		clusterNames = append(clusterNames, clusterName)
+	}
+	sort.Strings(clusterNames)
+	report.Clusters = make([]ClusterReport, len(clusterNames))
+
+	parallelism := opts.Parallelism
+	if parallelism <= 0 || parallelism > len(clusterNames) {
+		parallelism = len(clusterNames)
+	}
+	sem := make(chan struct{}, parallelism)
+
+	var wg sync.WaitGroup
+	for i, clusterName := range clusterNames {
+		wg.Add(1)
+		go func(clusterReport *ClusterReport, clusterName string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			*clusterReport = runCluster(clusterName, func(logger Logger) ClusterReport {
+				PrintAndLog(fmt.Sprintf("Testing Cluster: %s\n", clusterName), logger)
+				return smokeTestCluster(&CheckEnv{
+					ClusterName:      clusterName,
+					KubeAccess:       kubeAccess[clusterName],
+					Resources:        resources,
+					DesiredNodeCount: clusterNodeCount[clusterName],
+					NodeGroups:       clusterNodeGroups[clusterName],
+					NodeRoleARNs:     clusterNodeRoles[clusterName],
+					Options:          opts,
+					Logger:           logger,
+				})
+			})
+		}(&report.Clusters[i], clusterName)
+	}
+	wg.Wait()
+
+	return report
+}
+
+// smokeTestCluster runs a checklist of operational successes required to deem
+// the EKS cluster as successfully running and ready for use.
+func smokeTestCluster(env *CheckEnv) ClusterReport {
+	report := ClusterReport{
+		Name:             env.ClusterName,
+		DesiredNodeCount: env.DesiredNodeCount,
+		NodeGroups:       env.NodeGroups,
+	}
+
+	version, err := LogAPIServerVersion(env.Logger, env.KubeAccess.Clientset)
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	report.ServerVersion = fmt.Sprintf("%s.%s", version.Major, version.Minor)
+	report.ServerGitVersion = version.GitVersion
+
+	checks, err := env.Options.Checks.Checks()
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+
+	// Run all checks.
+	report.Checks = runChecks(checks, env)
+	return report
+}
@@ -0,0 +1,184 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/pulumi/pulumi/sdk/v2/go/common/apitype"
+	"github.com/pulumi/pulumi/sdk/v2/go/common/resource"
+)
+
+// minStackExportVersion is the oldest deployment schema version that can be
+// read from a stack export.
+const minStackExportVersion = 3
+
+// StackExport is the state of a Pulumi stack, as written by
+// `pulumi stack export`. It lets the smoke test run against an existing stack
+// outside of the integration test framework.
+type StackExport struct {
+	// Resources are the Pulumi stack resources.
+	Resources []apitype.ResourceV3
+	// Outputs are the outputs of the stack. Secret outputs are only readable
+	// if the stack was exported with --show-secrets.
+	Outputs map[string]interface{}
+}
+
+// LoadStackExport reads a `pulumi stack export` file.
+func LoadStackExport(path string) (*StackExport, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	export, err := ParseStackExport(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing stack export %s: %w", path, err)
+	}
+	return export, nil
+}
+
+// ParseStackExport parses the JSON of an untyped deployment, as written by
+// `pulumi stack export`. Deployment versions 3 and later are supported.
+func ParseStackExport(data []byte) (*StackExport, error) {
+	var untyped apitype.UntypedDeployment
+	if err := json.Unmarshal(data, &untyped); err != nil {
+		return nil, err
+	}
+	if untyped.Version < minStackExportVersion {
+		return nil, fmt.Errorf("unsupported deployment version %d, expected %d or later",
+			untyped.Version, minStackExportVersion)
+	}
+
+	// Later versions are read as the current version, ignoring any fields the
+	// current version does not know about.
+	var deployment apitype.DeploymentV3
+	if err := json.Unmarshal(untyped.Deployment, &deployment); err != nil {
+		return nil, err
+	}
+
+	export := &StackExport{
+		Resources: deployment.Resources,
+		Outputs:   make(map[string]interface{}),
+	}
+	for _, res := range deployment.Resources {
+		if res.Type != resource.RootStackType {
+			continue
+		}
+		for name, value := range res.Outputs {
+			export.Outputs[name] = unwrapSecrets(value)
+		}
+	}
+	return export, nil
+}
+
+// unwrapSecrets replaces the secrets in value with their plaintext, if they
+// were exported with --show-secrets.
+func unwrapSecrets(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if v[resource.SigKey] == resource.SecretSig {
+			plaintext, ok := v["plaintext"].(string)
+			if !ok {
+				return v
+			}
+			var unwrapped interface{}
+			if err := json.Unmarshal([]byte(plaintext), &unwrapped); err != nil {
+				return plaintext
+			}
+			return unwrapSecrets(unwrapped)
+		}
+		for key, elem := range v {
+			v[key] = unwrapSecrets(elem)
+		}
+		return v
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = unwrapSecrets(elem)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// Kubeconfigs returns the stack outputs that are kubeconfigs, in order of
+// output name. Each can be passed to RunSmokeTest.
+//
+// Outputs that are kubeconfig objects are returned as is, and outputs that
+// are serialized kubeconfigs are returned as a []byte.
+func (s *StackExport) Kubeconfigs() []interface{} {
+	names := make([]string, 0, len(s.Outputs))
+	for name := range s.Outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var kubeconfigs []interface{}
+	for _, name := range names {
+		switch v := s.Outputs[name].(type) {
+		case map[string]interface{}:
+			if isKubeconfig(v) {
+				kubeconfigs = append(kubeconfigs, v)
+			}
+		case string:
+			var obj map[string]interface{}
+			if err := json.Unmarshal([]byte(v), &obj); err == nil && isKubeconfig(obj) {
+				kubeconfigs = append(kubeconfigs, []byte(v))
+			}
+		}
+	}
+	return kubeconfigs
+}
+
+// isKubeconfig reports whether obj is a kubeconfig.
+func isKubeconfig(obj map[string]interface{}) bool {
+	return obj["apiVersion"] == "v1" && obj["kind"] == "Config"
+}
+
+// DesiredNodeCounts returns the total desired worker Node count of each
+// cluster in the stack, across all of its NodeGroups.
+func (s *StackExport) DesiredNodeCounts() (map[string]int, error) {
+	return mapClusterToNodeCount(s.Resources)
+}
+
+// NodeGroups returns the node groups of each cluster in the stack, and their
+// desired Node counts.
+func (s *StackExport) NodeGroups() (map[string][]NodeGroup, error) {
+	return mapClusterToNodeGroups(s.Resources)
+}
+
+// NodeRoleARNs returns the ARNs of the IAM roles of the worker Nodes of each
+// cluster in the stack, which must be mapped in its aws-auth ConfigMap.
+func (s *StackExport) NodeRoleARNs() (map[string][]string, error) {
+	return mapClusterToNodeRoles(s.Resources)
+}
+
+// AWSRegion returns the region of the default AWS provider of the stack, i.e.
+// its aws:region config, or "" if the stack has none.
+func (s *StackExport) AWSRegion() string {
+	return stackAWSRegion(s.Resources)
+}
+
+// awsProviderType is the type of the AWS provider resources.
+const awsProviderType = "pulumi:providers:aws"
+
+// stackAWSRegion returns the region of the default AWS provider of the stack,
+// which is configured by aws:region. Default providers are named "default",
+// or "default_<version>" if the provider version is pinned.
+func stackAWSRegion(resources []apitype.ResourceV3) string {
+	for _, res := range resources {
+		if res.Type != awsProviderType {
+			continue
+		}
+		name := string(res.URN.Name())
+		if name != "default" && !strings.HasPrefix(name, "default_") {
+			continue
+		}
+		if region, ok := res.Inputs["region"].(string); ok && region != "" {
+			return region
+		}
+	}
+	return ""
+}
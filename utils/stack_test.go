@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testStackExport is a `pulumi stack export --show-secrets` of a stack like
+// the nodegroup example: a cluster with the default instance role and node
+// group, and a cluster with instanceRoles used by a self-managed and a
+// managed node group.
+var testStackExport = filepath.Join("testdata", "stack", "nodegroup.json")
+
+func TestLoadStackExport(t *testing.T) {
+	export, err := LoadStackExport(testStackExport)
+	require.NoError(t, err)
+	assert.Len(t, export.Resources, 27)
+	assert.Equal(t, "example-cluster-eksCluster-5f0e9c1", export.Outputs["clusterName"])
+	assert.Equal(t, "us-west-2", export.AWSRegion())
+
+	// Kubeconfigs are output as an object, and as a secret string.
+	kubeconfigs := export.Kubeconfigs()
+	require.Len(t, kubeconfigs, 2)
+	object, ok := kubeconfigs[0].(map[string]interface{})
+	require.True(t, ok, "%T", kubeconfigs[0])
+	assert.Equal(t, "Config", object["kind"])
+	serialized, ok := kubeconfigs[1].([]byte)
+	require.True(t, ok, "%T", kubeconfigs[1])
+	var config struct {
+		Clusters []struct {
+			Cluster struct {
+				Server string `json:"server"`
+			} `json:"cluster"`
+		} `json:"clusters"`
+	}
+	require.NoError(t, json.Unmarshal(serialized, &config))
+	require.Len(t, config.Clusters, 1)
+	assert.Equal(t, "https://9F8E7D6C5B4A39281706F5E4D3C2B1A0.yl4.us-west-2.eks.amazonaws.com",
+		config.Clusters[0].Cluster.Server)
+
+	_, err = LoadStackExport(filepath.Join("testdata", "stack", "version2.json"))
+	assert.EqualError(t, err, "parsing stack export testdata/stack/version2.json: "+
+		"unsupported deployment version 2, expected 3 or later")
+	_, err = LoadStackExport(filepath.Join("testdata", "stack", "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestParseStackExport(t *testing.T) {
+	for name, tc := range map[string]struct {
+		data    string
+		outputs map[string]interface{}
+		err     string
+	}{
+		"later version": {
+			data: `{"version": 4, "deployment": {"resources": [{"urn": "urn:pulumi:dev::p::pulumi:pulumi:Stack::p-dev",
+				"type": "pulumi:pulumi:Stack", "outputs": {"url": "http://example.com"}, "newField": true}]}}`,
+			outputs: map[string]interface{}{"url": "http://example.com"},
+		},
+		"nested secrets": {
+			data: `{"version": 3, "deployment": {"resources": [{"urn": "urn:pulumi:dev::p::pulumi:pulumi:Stack::p-dev",
+				"type": "pulumi:pulumi:Stack", "outputs": {
+					"password": {"4dabf18193072939515e22adb298388d": "1b47061264138c4ac30d75fd1eb44270",
+						"plaintext": "\"hunter2\""},
+					"db": {"port": 5432, "users": [{"4dabf18193072939515e22adb298388d": "1b47061264138c4ac30d75fd1eb44270",
+						"plaintext": "{\"name\":\"admin\"}"}]}
+				}}]}}`,
+			outputs: map[string]interface{}{
+				"password": "hunter2",
+				"db":       map[string]interface{}{"port": float64(5432), "users": []interface{}{map[string]interface{}{"name": "admin"}}},
+			},
+		},
+		"secrets without --show-secrets": {
+			data: `{"version": 3, "deployment": {"resources": [{"urn": "urn:pulumi:dev::p::pulumi:pulumi:Stack::p-dev",
+				"type": "pulumi:pulumi:Stack", "outputs": {
+					"password": {"4dabf18193072939515e22adb298388d": "1b47061264138c4ac30d75fd1eb44270",
+						"ciphertext": "v1:abc"}
+				}}]}}`,
+			outputs: map[string]interface{}{"password": map[string]interface{}{
+				"4dabf18193072939515e22adb298388d": "1b47061264138c4ac30d75fd1eb44270",
+				"ciphertext":                       "v1:abc",
+			}},
+		},
+		"version 1": {
+			data: `{"version": 1, "deployment": {}}`,
+			err:  "unsupported deployment version 1, expected 3 or later",
+		},
+		"not JSON": {
+			data: `version: 3`,
+			err:  "invalid character 'v' looking for beginning of value",
+		},
+	} {
+		export, err := ParseStackExport([]byte(tc.data))
+		if tc.err != "" {
+			assert.EqualError(t, err, tc.err, name)
+			continue
+		}
+		if assert.NoError(t, err, name) {
+			assert.Equal(t, tc.outputs, export.Outputs, name)
+		}
+	}
+}
+
+func TestStackExportKubeconfigs(t *testing.T) {
+	kubeconfig := map[string]interface{}{"apiVersion": "v1", "kind": "Config", "clusters": []interface{}{}}
+	serialized, err := json.Marshal(kubeconfig)
+	require.NoError(t, err)
+
+	export := &StackExport{Outputs: map[string]interface{}{
+		"b-object": kubeconfig,
+		"a-string": string(serialized),
+		"c-other":  map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap"},
+		"d-url":    "http://example.com",
+		"e-json":   `{"kind": "Config"}`,
+	}}
+	assert.Equal(t, []interface{}{serialized, kubeconfig}, export.Kubeconfigs())
+}
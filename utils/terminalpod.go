@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TerminalPodPolicy decides how terminal Pods, i.e. Pods that have failed and
+// will not be restarted, are evaluated when a ready Pod of the same controller
+// has replaced them. Pods evicted by a Node drain are left behind as Failed,
+// although their ReplicaSet, Job, etc. has already replaced them. Terminal
+// Pods whose replacement is not ready, e.g. still Pending, are not ready
+// under any policy.
+type TerminalPodPolicy string
+
+const (
+	// TerminalPodsReport reports replaced terminal Pods as ready, noting the
+	// Pod that replaced them in their reason.
+	TerminalPodsReport TerminalPodPolicy = "report"
+	// TerminalPodsIgnore omits replaced terminal Pods from the readiness
+	// status.
+	TerminalPodsIgnore TerminalPodPolicy = "ignore"
+	// TerminalPodsFail reports all terminal Pods as not ready, whether they
+	// were replaced or not.
+	TerminalPodsFail TerminalPodPolicy = "fail"
+)
+
+// ParseTerminalPodPolicy parses the name of a TerminalPodPolicy. The empty
+// string is TerminalPodsReport.
+func ParseTerminalPodPolicy(s string) (TerminalPodPolicy, error) {
+	switch policy := TerminalPodPolicy(s); policy {
+	case "":
+		return TerminalPodsReport, nil
+	case TerminalPodsReport, TerminalPodsIgnore, TerminalPodsFail:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown terminal Pod policy %q: must be one of %s, %s or %s",
+		s, TerminalPodsReport, TerminalPodsIgnore, TerminalPodsFail)
+}
+
+// TerminalPodReplacement returns the Pod among pods that replaced a terminal
+// Pod, or nil if the Pod is not terminal or has not been replaced. A Pod is
+// replaced by a Pod of the same controller, created no earlier, that is
+// pending, running or has succeeded. Pods without a controller are never
+// replaced.
+func TerminalPodReplacement(pod *corev1.Pod, pods []*corev1.Pod) *corev1.Pod {
+	if pod.Status.Phase != corev1.PodFailed {
+		return nil
+	}
+	controller := metav1.GetControllerOf(pod)
+	if controller == nil {
+		return nil
+	}
+
+	var replacement *corev1.Pod
+	for _, p := range pods {
+		if p.Namespace != pod.Namespace || p.UID == pod.UID || p.Status.Phase == corev1.PodFailed ||
+			p.DeletionTimestamp != nil || p.CreationTimestamp.Before(&pod.CreationTimestamp) {
+			continue
+		}
+		if c := metav1.GetControllerOf(p); c == nil || c.UID != controller.UID {
+			continue
+		}
+		// Prefer the latest replacement, so that the choice is stable.
+		if replacement == nil || replacement.CreationTimestamp.Before(&p.CreationTimestamp) ||
+			(replacement.CreationTimestamp.Equal(&p.CreationTimestamp) && p.Name > replacement.Name) {
+			replacement = p
+		}
+	}
+	return replacement
+}
@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// replicaSetPod returns a Pod of the ReplicaSet web-5d9f8, created at the
+// given minute, in the given phase and, if Running, ready or not.
+func replicaSetPod(name string, minute int, phase corev1.PodPhase, ready bool) *corev1.Pod {
+	controller := true
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "default",
+			Name:              name,
+			UID:               types.UID(name),
+			CreationTimestamp: metav1.NewTime(time.Date(2020, 4, 1, 12, minute, 0, 0, time.UTC)),
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "web-5d9f8", UID: "web-5d9f8", Controller: &controller},
+			},
+		},
+		Status: corev1.PodStatus{Phase: phase},
+	}
+	switch {
+	case phase == corev1.PodFailed:
+		pod.Status.Reason = "Evicted"
+		pod.Status.Message = "The node was low on resource: memory."
+	case ready:
+		pod.Status.Conditions = []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}
+	}
+	return pod
+}
+
+func TestTerminalPodReplacement(t *testing.T) {
+	evicted := replicaSetPod("web-5d9f8-abcde", 1, corev1.PodFailed, false)
+	older := replicaSetPod("web-5d9f8-older", 0, corev1.PodRunning, true)
+	failed := replicaSetPod("web-5d9f8-failed", 2, corev1.PodFailed, false)
+	pending := replicaSetPod("web-5d9f8-fghij", 2, corev1.PodPending, false)
+	running := replicaSetPod("web-5d9f8-klmno", 2, corev1.PodRunning, true)
+	other := replicaSetPod("api-7c4b2-pqrst", 3, corev1.PodRunning, true)
+	other.OwnerReferences[0].UID = "api-7c4b2"
+	orphan := replicaSetPod("debug", 1, corev1.PodFailed, false)
+	orphan.OwnerReferences = nil
+
+	// Older, failed and foreign Pods are not replacements.
+	assert.Nil(t, TerminalPodReplacement(evicted, []*corev1.Pod{evicted, older, failed, other}))
+	// Among replacements created at the same time, the choice is stable.
+	assert.Equal(t, running, TerminalPodReplacement(evicted, []*corev1.Pod{running, evicted, pending}))
+	assert.Equal(t, running, TerminalPodReplacement(evicted, []*corev1.Pod{pending, evicted, running}))
+	// Pods that are not terminal, or have no controller, are never replaced.
+	assert.Nil(t, TerminalPodReplacement(pending, []*corev1.Pod{pending, running}))
+	assert.Nil(t, TerminalPodReplacement(orphan, []*corev1.Pod{orphan, running}))
+}
+
+func TestReadinessTrackerTerminalPods(t *testing.T) {
+	const evictedReason = "Failed: Evicted: The node was low on resource: memory."
+	evicted := replicaSetPod("web-5d9f8-abcde", 1, corev1.PodFailed, false)
+	pending := replicaSetPod("web-5d9f8-fghij", 2, corev1.PodPending, false)
+	running := replicaSetPod("web-5d9f8-klmno", 2, corev1.PodRunning, true)
+
+	for name, tc := range map[string]struct {
+		policy      TerminalPodPolicy
+		replacement *corev1.Pod
+		expected    []ObjectStatus
+	}{
+		"report a ready replacement": {
+			policy:      TerminalPodsReport,
+			replacement: running,
+			expected: []ObjectStatus{
+				{Kind: "Pod", Namespace: "default", Name: "web-5d9f8-abcde", Ready: true,
+					Reason: evictedReason + "; replaced by Pod web-5d9f8-klmno"},
+				{Kind: "Pod", Namespace: "default", Name: "web-5d9f8-klmno", Ready: true},
+			},
+		},
+		"report a pending replacement": {
+			policy:      TerminalPodsReport,
+			replacement: pending,
+			expected: []ObjectStatus{
+				{Kind: "Pod", Namespace: "default", Name: "web-5d9f8-abcde",
+					Reason: evictedReason + "; replaced by Pod web-5d9f8-fghij, which is not ready"},
+				{Kind: "Pod", Namespace: "default", Name: "web-5d9f8-fghij", Reason: "Pending"},
+			},
+		},
+		"ignore a ready replacement": {
+			policy:      TerminalPodsIgnore,
+			replacement: running,
+			expected: []ObjectStatus{
+				{Kind: "Pod", Namespace: "default", Name: "web-5d9f8-klmno", Ready: true},
+			},
+		},
+		"ignore a pending replacement": {
+			policy:      TerminalPodsIgnore,
+			replacement: pending,
+			expected: []ObjectStatus{
+				{Kind: "Pod", Namespace: "default", Name: "web-5d9f8-abcde",
+					Reason: evictedReason + "; replaced by Pod web-5d9f8-fghij, which is not ready"},
+				{Kind: "Pod", Namespace: "default", Name: "web-5d9f8-fghij", Reason: "Pending"},
+			},
+		},
+		"fail with a ready replacement": {
+			policy:      TerminalPodsFail,
+			replacement: running,
+			expected: []ObjectStatus{
+				{Kind: "Pod", Namespace: "default", Name: "web-5d9f8-abcde", Reason: evictedReason},
+				{Kind: "Pod", Namespace: "default", Name: "web-5d9f8-klmno", Ready: true},
+			},
+		},
+		"default policy": {
+			replacement: running,
+			expected: []ObjectStatus{
+				{Kind: "Pod", Namespace: "default", Name: "web-5d9f8-abcde", Ready: true,
+					Reason: evictedReason + "; replaced by Pod web-5d9f8-klmno"},
+				{Kind: "Pod", Namespace: "default", Name: "web-5d9f8-klmno", Ready: true},
+			},
+		},
+	} {
+		r := newReadinessTracker(nil)
+		r.Filter.TerminalPods = tc.policy
+		r.reported["Pod"] = true
+		r.objects["Pod"] = map[string]runtime.Object{
+			"default/" + evicted.Name:        evicted,
+			"default/" + tc.replacement.Name: tc.replacement,
+		}
+		status := r.Status()
+		assert.Equal(t, tc.expected, status.Objects, name)
+		assert.Equal(t, tc.policy != TerminalPodsFail && tc.replacement == running, status.AllReady(), name)
+	}
+}
+
+func TestParseTerminalPodPolicy(t *testing.T) {
+	for _, s := range []string{"", "report", "ignore", "fail"} {
+		policy, err := ParseTerminalPodPolicy(s)
+		assert.NoError(t, err, s)
+		if s == "" {
+			assert.Equal(t, TerminalPodsReport, policy)
+		} else {
+			assert.Equal(t, TerminalPodPolicy(s), policy)
+		}
+	}
+	_, err := ParseTerminalPodPolicy("skip")
+	assert.EqualError(t, err, `unknown terminal Pod policy "skip": must be one of report, ignore or fail`)
+}
@@ -0,0 +1,246 @@
+package utils
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/client-go/kubernetes"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// eksTokenPrefix is the prefix of EKS bearer tokens, followed by the
+	// base64 encoded presigned GetCallerIdentity URL.
+	eksTokenPrefix = "k8s-aws-v1."
+	// eksClusterIDHeader is the header of the presigned GetCallerIdentity
+	// request that binds the token to an EKS cluster.
+	eksClusterIDHeader = "x-k8s-aws-id"
+	// presignedURLExpiry is the expiry of the presigned GetCallerIdentity URL.
+	// EKS accepts tokens for 15 minutes, regardless of the expiry.
+	presignedURLExpiry = 60 * time.Second
+	// eksTokenExpiry is how long a token is used for, a minute less than EKS
+	// accepts it for.
+	eksTokenExpiry = 14 * time.Minute
+	// eksTokenExpiryWindow is how long before they expire that cached tokens
+	// are regenerated.
+	eksTokenExpiryWindow = time.Minute
+	// stsGlobalRegion is the signing region of the global STS endpoint, which
+	// tokens are presigned for when the region of the cluster is unknown.
+	stsGlobalRegion = "us-east-1"
+)
+
+// EKSToken is a bearer token that authenticates an IAM identity to EKS
+// clusters, as generated by `aws eks get-token`.
+type EKSToken struct {
+	Token      string
+	Expiration time.Time
+}
+
+// EKSTokenGenerator generates EKS bearer tokens natively, without the exec
+// credential plugin of a kubeconfig, i.e. without the `aws` CLI or
+// `aws-iam-authenticator`.
+type EKSTokenGenerator struct {
+	// ClusterName is the name of the EKS cluster that tokens are for.
+	ClusterName string
+	// Session provides the credentials of the IAM identity that tokens
+	// authenticate, and the region of the STS endpoint that GetCallerIdentity
+	// requests are presigned for.
+	Session *session.Session
+}
+
+// Token generates a token, i.e. a presigned STS GetCallerIdentity URL, with
+// the header of the cluster name, encoded with the EKS token prefix.
+func (g *EKSTokenGenerator) Token() (EKSToken, error) {
+	if g.ClusterName == "" {
+		return EKSToken{}, fmt.Errorf("generating EKS token: cluster name is not set")
+	}
+
+	now := time.Now()
+	req, _ := sts.New(g.Session).GetCallerIdentityRequest(&sts.GetCallerIdentityInput{})
+	req.HTTPRequest.Header.Add(eksClusterIDHeader, g.ClusterName)
+	presignedURL, err := req.Presign(presignedURLExpiry)
+	if err != nil {
+		return EKSToken{}, fmt.Errorf("generating EKS token for cluster %q: %w", g.ClusterName, err)
+	}
+
+	// The presigned URL is rejected once the credentials expire.
+	expiration := now.Add(eksTokenExpiry)
+	if expires, err := g.Session.Config.Credentials.ExpiresAt(); err == nil && expires.Before(expiration) {
+		expiration = expires
+	}
+	return EKSToken{
+		Token:      eksTokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(presignedURL)),
+		Expiration: expiration,
+	}, nil
+}
+
+// WrapTransport wraps rt to authenticate requests with tokens of the
+// generator. Tokens are cached until shortly before they expire. Requests
+// that already have an Authorization header are sent as is.
+func (g *EKSTokenGenerator) WrapTransport(rt http.RoundTripper) http.RoundTripper {
+	return &eksTokenRoundTripper{generator: g, rt: rt}
+}
+
+// ConfigureRESTConfig configures config to authenticate with tokens of the
+// generator, in place of its exec credential plugin, auth provider or bearer
+// token.
+func (g *EKSTokenGenerator) ConfigureRESTConfig(config *restclient.Config) {
+	config.ExecProvider = nil
+	config.AuthProvider = nil
+	config.BearerToken = ""
+	config.BearerTokenFile = ""
+	config.Wrap(g.WrapTransport)
+}
+
+type eksTokenRoundTripper struct {
+	generator *EKSTokenGenerator
+	rt        http.RoundTripper
+
+	mu    sync.Mutex
+	token EKSToken
+}
+
+func (t *eksTokenRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Authorization") != "" {
+		return t.rt.RoundTrip(req)
+	}
+	token, err := t.currentToken()
+	if err != nil {
+		return nil, err
+	}
+	req = utilnet.CloneRequest(req)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return t.rt.RoundTrip(req)
+}
+
+// currentToken returns the cached token, or a new one if it is about to
+// expire.
+func (t *eksTokenRoundTripper) currentToken() (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token.Token != "" && time.Now().Add(eksTokenExpiryWindow).Before(t.token.Expiration) {
+		return t.token.Token, nil
+	}
+	token, err := t.generator.Token()
+	if err != nil {
+		return "", err
+	}
+	t.token = token
+	return token.Token, nil
+}
+
+func (t *eksTokenRoundTripper) WrappedRoundTripper() http.RoundTripper { return t.rt }
+
+// NewEKSTokenGeneratorFromKubeconfig creates a token generator equivalent to
+// the exec credential plugin of the current context of a kubeconfig:
+//
+//   - the cluster name is resolved with ClusterName,
+//   - the role of the `--role-arn` or `--role` args, if any, is assumed,
+//   - the profile of the AWS_PROFILE env of the plugin, if any, provides the
+//     credentials, otherwise the default credential chain of the AWS SDK
+//     does,
+//   - tokens are signed for the regional STS endpoint of the region of the
+//     cluster endpoint.
+func NewEKSTokenGeneratorFromKubeconfig(kubeconfig []byte) (*EKSTokenGenerator, error) {
+	clusterName, err := ClusterName(kubeconfig, nil)
+	if err != nil {
+		return nil, err
+	}
+	config, err := clientcmd.Load(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	context := config.Contexts[config.CurrentContext]
+
+	var region string
+	if cluster, ok := config.Clusters[context.Cluster]; ok {
+		region = regionFromEKSEndpoint(cluster.Server)
+	}
+	var profile, roleARN string
+	if authInfo, ok := config.AuthInfos[context.AuthInfo]; ok && authInfo.Exec != nil {
+		roleARN = execFlagValue(authInfo.Exec.Args, "--role-arn", "--role", "-r")
+		for _, env := range authInfo.Exec.Env {
+			if env.Name == "AWS_PROFILE" {
+				profile = env.Value
+			}
+		}
+	}
+
+	awsConfig := aws.Config{STSRegionalEndpoint: endpoints.RegionalSTSEndpoint}
+	if region != "" {
+		awsConfig.Region = aws.String(region)
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            awsConfig,
+		Profile:           profile,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating AWS session: %w", err)
+	}
+	if aws.StringValue(sess.Config.Region) == "" {
+		sess.Config.Region = aws.String(stsGlobalRegion)
+	}
+	if roleARN != "" {
+		sess = sess.Copy(&aws.Config{Credentials: stscreds.NewCredentials(sess, roleARN)})
+	}
+	return &EKSTokenGenerator{ClusterName: clusterName, Session: sess}, nil
+}
+
+// regionFromEKSEndpoint returns the region of an EKS cluster endpoint, e.g.
+// "us-west-2" for "https://ABC.gr7.us-west-2.eks.amazonaws.com", or "" if the
+// endpoint is not one of EKS.
+func regionFromEKSEndpoint(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return ""
+	}
+	labels := strings.Split(u.Hostname(), ".")
+	for i := 1; i+1 < len(labels); i++ {
+		if labels[i] == "eks" && labels[i+1] == "amazonaws" {
+			return labels[i-1]
+		}
+	}
+	return ""
+}
+
+// KubeconfigToNativeKubeAccess creates a KubeAccess object from a serialized
+// kubeconfig, like KubeconfigToKubeAccess, but authenticates with tokens
+// generated by NewEKSTokenGeneratorFromKubeconfig rather than by the exec
+// credential plugin of the kubeconfig.
+func KubeconfigToNativeKubeAccess(kubeconfig []byte) (*KubeAccess, error) {
+	if err := IsKubeconfigValid(kubeconfig); err != nil {
+		return nil, err
+	}
+	generator, err := NewEKSTokenGeneratorFromKubeconfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	restConfig, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	generator.ConfigureRESTConfig(restConfig)
+
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &KubeAccess{
+		restConfig,
+		clientset,
+	}, nil
+}
@@ -0,0 +1,267 @@
+package utils
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testAccessKeyID     = "AKIDEXAMPLE"
+	testSecretAccessKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	testRoleARN         = "arn:aws:iam::123456789012:role/dev"
+	testRoleAccessKeyID = "ASIAROLEEXAMPLE"
+	testRoleToken       = "roleSessionTokenEXAMPLE"
+)
+
+// testSession returns a session of the test credentials in us-west-2,
+// calling endpoint, if any, in place of the AWS endpoints.
+func testSession(t *testing.T, endpoint string) *session.Session {
+	config := &aws.Config{
+		Region:      aws.String("us-west-2"),
+		Credentials: credentials.NewStaticCredentials(testAccessKeyID, testSecretAccessKey, ""),
+		MaxRetries:  aws.Int(0),
+	}
+	if endpoint != "" {
+		config.Endpoint = aws.String(endpoint)
+	}
+	sess, err := session.NewSession(config)
+	require.NoError(t, err)
+	return sess
+}
+
+// stubSTS is a local STS server that assumes a role for the test credentials.
+type stubSTS struct {
+	t      *testing.T
+	server *httptest.Server
+	// expires is when the credentials of the role expire.
+	expires time.Time
+	// assumed counts the AssumeRole calls.
+	assumed int
+}
+
+func newStubSTS(t *testing.T) *stubSTS {
+	s := &stubSTS{t: t, expires: time.Now().Add(15 * time.Minute).UTC().Truncate(time.Second)}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// serveHTTP runs on the goroutine of the server, so it reports failures with
+// assert rather than require.
+func (s *stubSTS) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if !assert.NoError(s.t, err) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	form, err := url.ParseQuery(string(body))
+	if !assert.NoError(s.t, err) || !assert.Equal(s.t, "AssumeRole", form.Get("Action")) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	assert.Equal(s.t, testRoleARN, form.Get("RoleArn"))
+	assert.Equal(s.t, "900", form.Get("DurationSeconds"))
+	assert.Contains(s.t, r.Header.Get("Authorization"), "Credential="+testAccessKeyID+"/")
+	assert.Contains(s.t, r.Header.Get("Authorization"), "/us-west-2/sts/aws4_request")
+	s.assumed++
+	fmt.Fprintf(w, `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>%s</AccessKeyId>
+      <SecretAccessKey>roleSecretEXAMPLEKEY</SecretAccessKey>
+      <SessionToken>%s</SessionToken>
+      <Expiration>%s</Expiration>
+    </Credentials>
+  </AssumeRoleResult>
+</AssumeRoleResponse>`, testRoleAccessKeyID, testRoleToken, s.expires.Format(time.RFC3339))
+}
+
+func TestEKSTokenAssumedRole(t *testing.T) {
+	stub := newStubSTS(t)
+	defer stub.server.Close()
+	sess := testSession(t, stub.server.URL+"/")
+	generator := &EKSTokenGenerator{
+		ClusterName: "my-cluster",
+		Session:     sess.Copy(&aws.Config{Credentials: stscreds.NewCredentials(sess, testRoleARN)}),
+	}
+
+	before := time.Now()
+	token, err := generator.Token()
+	require.NoError(t, err)
+	// The credentials of the role expire after the 14 minutes of the token.
+	assert.False(t, token.Expiration.Before(before.Add(14*time.Minute)), token.Expiration)
+	assert.True(t, token.Expiration.Before(stub.expires), token.Expiration)
+
+	require.True(t, strings.HasPrefix(token.Token, "k8s-aws-v1."))
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token.Token, "k8s-aws-v1."))
+	require.NoError(t, err)
+	presigned, err := url.Parse(string(decoded))
+	require.NoError(t, err)
+	query := presigned.Query()
+	assert.Equal(t, "GetCallerIdentity", query.Get("Action"))
+	assert.Equal(t, "2011-06-15", query.Get("Version"))
+	assert.Equal(t, "60", query.Get("X-Amz-Expires"))
+	assert.True(t, strings.HasPrefix(query.Get("X-Amz-Credential"), testRoleAccessKeyID+"/"),
+		query.Get("X-Amz-Credential"))
+	assert.True(t, strings.HasSuffix(query.Get("X-Amz-Credential"), "/us-west-2/sts/aws4_request"),
+		query.Get("X-Amz-Credential"))
+	assert.Equal(t, "host;x-k8s-aws-id", query.Get("X-Amz-SignedHeaders"))
+	assert.Equal(t, testRoleToken, query.Get("X-Amz-Security-Token"))
+
+	// The credentials of the role are cached.
+	_, err = generator.Token()
+	require.NoError(t, err)
+	assert.Equal(t, 1, stub.assumed)
+}
+
+// expiringProvider provides the test credentials, expiring at a given time.
+type expiringProvider struct {
+	credentials.Expiry
+}
+
+func (p *expiringProvider) Retrieve() (credentials.Value, error) {
+	return credentials.Value{AccessKeyID: testAccessKeyID, SecretAccessKey: testSecretAccessKey}, nil
+}
+
+func TestEKSTokenExpiresWithCredentials(t *testing.T) {
+	provider := &expiringProvider{}
+	expires := time.Now().Add(5 * time.Minute)
+	provider.SetExpiration(expires, 0)
+	generator := &EKSTokenGenerator{
+		ClusterName: "my-cluster",
+		Session:     testSession(t, "").Copy(&aws.Config{Credentials: credentials.NewCredentials(provider)}),
+	}
+	token, err := generator.Token()
+	require.NoError(t, err)
+	assert.True(t, expires.Equal(token.Expiration), token.Expiration)
+}
+
+func TestEKSTokenTransport(t *testing.T) {
+	var tokens []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokens = append(tokens, r.Header.Get("Authorization"))
+	}))
+	defer server.Close()
+
+	generator := &EKSTokenGenerator{ClusterName: "my-cluster", Session: testSession(t, "")}
+	client := &http.Client{Transport: generator.WrapTransport(http.DefaultTransport)}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	require.Len(t, tokens, 2)
+	assert.True(t, strings.HasPrefix(tokens[0], "Bearer k8s-aws-v1."), tokens[0])
+	assert.Equal(t, tokens[0], tokens[1], "the token is cached")
+}
+
+func TestNewEKSTokenGeneratorFromKubeconfig(t *testing.T) {
+	dir := t.TempDir()
+	credentialsFile := filepath.Join(dir, "credentials")
+	require.NoError(t, ioutil.WriteFile(credentialsFile, []byte(`[default]
+aws_access_key_id = AKIDDEFAULT
+aws_secret_access_key = defaultSecret
+
+[dev]
+aws_access_key_id = AKIDEXAMPLE
+aws_secret_access_key = wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY
+`), 0600))
+	defer setEnv(t, "AWS_SHARED_CREDENTIALS_FILE", credentialsFile)()
+	defer setEnv(t, "AWS_CONFIG_FILE", filepath.Join(dir, "config"))()
+	defer unsetEnv(t, "AWS_ACCESS_KEY_ID")()
+	defer unsetEnv(t, "AWS_SECRET_ACCESS_KEY")()
+
+	kubeconfig := func(args string) []byte {
+		return []byte(`apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    server: https://ABCDEF.gr7.us-west-2.eks.amazonaws.com
+  name: kubernetes
+contexts:
+- context:
+    cluster: kubernetes
+    user: aws
+  name: aws
+current-context: aws
+users:
+- name: aws
+  user:
+    exec:
+      apiVersion: client.authentication.k8s.io/v1alpha1
+      command: aws
+      args: [` + args + `]
+      env:
+      - name: AWS_PROFILE
+        value: dev
+`)
+	}
+
+	generator, err := NewEKSTokenGeneratorFromKubeconfig(kubeconfig("eks, get-token, --cluster-name, my-cluster"))
+	require.NoError(t, err)
+	assert.Equal(t, "my-cluster", generator.ClusterName)
+	assert.Equal(t, "us-west-2", aws.StringValue(generator.Session.Config.Region))
+	value, err := generator.Session.Config.Credentials.Get()
+	require.NoError(t, err)
+	assert.Equal(t, testAccessKeyID, value.AccessKeyID)
+	assert.Equal(t, testSecretAccessKey, value.SecretAccessKey)
+	_, err = generator.Session.Config.Credentials.ExpiresAt()
+	assert.Error(t, err)
+
+	// Tokens are presigned for the regional STS endpoint.
+	token, err := generator.Token()
+	require.NoError(t, err)
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token.Token, "k8s-aws-v1."))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(decoded), "https://sts.us-west-2.amazonaws.com/?"), string(decoded))
+
+	// The role of the args is assumed with the credentials of the profile.
+	generator, err = NewEKSTokenGeneratorFromKubeconfig(kubeconfig(
+		"eks, get-token, --cluster-name, my-cluster, --role-arn, " + testRoleARN))
+	require.NoError(t, err)
+	// Unlike the static credentials of the profile, the credentials of the
+	// role expire.
+	_, err = generator.Session.Config.Credentials.ExpiresAt()
+	assert.NoError(t, err)
+}
+
+// setEnv sets an environment variable, and returns a func that restores it.
+func setEnv(t *testing.T, name, value string) func() {
+	old, ok := os.LookupEnv(name)
+	require.NoError(t, os.Setenv(name, value))
+	return restoreEnv(name, old, ok)
+}
+
+// unsetEnv unsets an environment variable, and returns a func that restores
+// it.
+func unsetEnv(t *testing.T, name string) func() {
+	old, ok := os.LookupEnv(name)
+	require.NoError(t, os.Unsetenv(name))
+	return restoreEnv(name, old, ok)
+}
+
+func restoreEnv(name, old string, ok bool) func() {
+	return func() {
+		if ok {
+			os.Setenv(name, old)
+		} else {
+			os.Unsetenv(name)
+		}
+	}
+}
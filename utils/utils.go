@@ -1,10 +1,11 @@
 package utils
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -12,295 +13,389 @@ import (
 	"github.com/pulumi/pulumi/sdk/v2/go/common/apitype"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
-	"gopkg.in/yaml.v2"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/version"
 	"k8s.io/client-go/kubernetes"
 	restclient "k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
-// Each resource request will be fetched from the Kubernetes API Server at a
-// max of 20 retries, with 15 seconds in between each attempt.
-// This creates a max wait time of upto 5 minutes that a resource request
-// must successfully return within, before moving on.
+// MaxRetries and RetryInterval define the default overall deadline of each
+// smoke test check: MaxRetries attempts, RetryInterval seconds apart, for a
+// max wait time of upto 10 minutes. Waits poll with an exponential backoff
+// capped at RetryInterval. See SmokeTestOptions to tune these per cluster.
 
-// MaxRetries is the maximum number of retries that a resource will be
-// attempted to be fetched from the Kubernetes API Server.
+// MaxRetries is the number of RetryInterval periods that make up the default
+// deadline of a smoke test check.
 const MaxRetries = 40
 
-// RetryInterval is the number of seconds to sleep in between requests
+// RetryInterval is the max number of seconds to sleep in between requests
 // to the Kubernetes API Server.
 const RetryInterval = 15
 
-// RunEKSSmokeTest instantiates the EKS Smoke Test.
-func RunEKSSmokeTest(t *testing.T, resources []apitype.ResourceV3, kubeconfigs ...interface{}) {
-	// Map the cluster name to the total desired Node count across all
-	// NodeGroups.
-	clusterNodeCount, err := mapClusterToNodeCount(resources)
-	if err != nil {
-		t.Error(err)
-	}
+// RunEKSSmokeTest instantiates the EKS Smoke Test using the
+// DefaultSmokeTestOptions, and returns its report.
+func RunEKSSmokeTest(t *testing.T, resources []apitype.ResourceV3, kubeconfigs ...interface{}) *SmokeTestReport {
+	return RunEKSSmokeTestWithOptions(t, DefaultSmokeTestOptions(), resources, kubeconfigs...)
+}
 
-	// Map the cluster name to the KubeAccess client-go tool bag.
-	kubeAccess, err := mapClusterToKubeAccess(kubeconfigs...)
-	if err != nil {
+// RunEKSSmokeTestWithOptions instantiates the EKS Smoke Test, running the
+// checks in opts bounded by its deadlines and poll intervals. Each cluster is
+// tested in its own subtest.
+//
+// It returns a report of the checks of each cluster, which is also written as
+// JSON to the location set in SmokeTestReportEnvVar, and as JUnit XML to the
+// location set in SmokeTestJUnitEnvVar, if any.
+func RunEKSSmokeTestWithOptions(t *testing.T, opts SmokeTestOptions, resources []apitype.ResourceV3,
+	kubeconfigs ...interface{}) *SmokeTestReport {
+	opts = opts.withDefaults()
+
+	// Subtests are run from the goroutines of runSmokeTest, rather than with
+	// t.Parallel, so that they complete before this returns and the stack is
+	// torn down.
+	report := runSmokeTest(opts, resources, kubeconfigs,
+		func(clusterName string, test func(Logger) ClusterReport) ClusterReport {
+			var clusterReport ClusterReport
+			t.Run(clusterName, func(t *testing.T) {
+				clusterReport = test(t)
+				if clusterReport.Error != "" {
+					t.Error(clusterReport.Error)
+				}
+				for _, result := range clusterReport.Checks {
+					if result.Status == CheckFailed {
+						t.Errorf("Check %q failed: %v", result.Name, result.Err)
+					}
+				}
+			})
+			return clusterReport
+		})
+	report.Test = t.Name()
+	for _, err := range report.Errors {
 		t.Error(err)
 	}
 
-	// Run the smoke test against each cluster, expecting the total desired
-	// Node count.
-	for clusterName := range kubeAccess {
-		PrintAndLog(fmt.Sprintf("Testing Cluster: %s\n", clusterName), t)
-		clientset := kubeAccess[clusterName].Clientset
-		eksSmokeTest(t, clientset, clusterNodeCount[clusterName])
+	if err := report.writeReportFiles(); err != nil {
+		t.Errorf("Failed to write smoke test report: %v", err)
 	}
-}
-
-// EKSSmokeTest runs a checklist of operational successes required to deem the
-// EKS cluster as successfully running and ready for use.
-func eksSmokeTest(t *testing.T, clientset *kubernetes.Clientset, desiredNodeCount int) {
-	APIServerVersionInfo(t, clientset)
-
-	// Run all tests.
-	assertEKSConfigMapReady(t, clientset)
-	AssertAllNodesReady(t, clientset, desiredNodeCount)
-	AssertKindInAllNamespacesReady(t, clientset, "pods")
+	return report
 }
 
 // APIServerVersionInfo prints out the API Server versions.
 func APIServerVersionInfo(t *testing.T, clientset *kubernetes.Clientset) {
-	version, err := clientset.DiscoveryClient.ServerVersion()
+	_, err := LogAPIServerVersion(t, clientset)
 	if err != nil {
 		t.Fatal(err)
 	}
-	PrintAndLog(fmt.Sprintf("API Server Version: %s.%s\n", version.Major, version.Minor), t)
-	PrintAndLog(fmt.Sprintf("API Server GitVersion: %s\n", version.GitVersion), t)
 }
 
-// assertEKSConfigMapReady ensures that the EKS aws-auth ConfigMap
-// exists and has data.
-func assertEKSConfigMapReady(t *testing.T, clientset *kubernetes.Clientset) {
-	awsAuthReady, retries := false, MaxRetries
-	configMapName, namespace := "aws-auth", "kube-system"
-	var awsAuth *corev1.ConfigMap
-	var err error
+// LogAPIServerVersion logs and returns the API Server versions.
+func LogAPIServerVersion(logger Logger, clientset kubernetes.Interface) (*version.Info, error) {
+	version, err := clientset.Discovery().ServerVersion()
+	if err != nil {
+		return nil, err
+	}
+	PrintAndLog(fmt.Sprintf("API Server Version: %s.%s\n", version.Major, version.Minor), logger)
+	PrintAndLog(fmt.Sprintf("API Server GitVersion: %s\n", version.GitVersion), logger)
+	return version, nil
+}
 
-	// Attempt to validate that the aws-auth ConfigMap exists.
-	for !awsAuthReady && retries > 0 {
-		awsAuth, err = clientset.CoreV1().ConfigMaps(namespace).Get(configMapName, metav1.GetOptions{})
-		retries--
-		if err != nil {
-			waitFor(t, fmt.Sprintf("ConfigMap %q", configMapName), "returned")
-			continue
+// assertCheck runs a single check against the cluster with the default
+// options, and requires that it passes.
+func assertCheck(t *testing.T, check Check, env *CheckEnv) {
+	env.Options = DefaultSmokeTestOptions()
+	env.Logger = t
+	result := runCheck(check, env)
+	require.NoError(t, result.Err, "Check %q failed", result.Name)
+}
+
+// WaitForEKSConfigMap waits for the EKS aws-auth ConfigMap to exist and have
+// valid data, polling with the default backoff. See ParseAWSAuth.
+func WaitForEKSConfigMap(ctx context.Context, logger Logger, clientset kubernetes.Interface) (ReadinessStatus, error) {
+	return waitForEKSConfigMap(ctx, logger, DefaultSmokeTestOptions().newBackoff(), clientset, nil)
+}
+
+// WaitForEKSConfigMapWithNodeRoles waits for the EKS aws-auth ConfigMap to
+// exist, have valid data, and map each of the IAM roles of the worker Nodes
+// to the Node groups, polling with the default backoff.
+func WaitForEKSConfigMapWithNodeRoles(ctx context.Context, logger Logger, clientset kubernetes.Interface,
+	nodeRoleARNs []string) (ReadinessStatus, error) {
+	return waitForEKSConfigMap(ctx, logger, DefaultSmokeTestOptions().newBackoff(), clientset, nodeRoleARNs)
+}
+
+func waitForEKSConfigMap(ctx context.Context, logger Logger, b *backoff,
+	clientset kubernetes.Interface, nodeRoleARNs []string) (ReadinessStatus, error) {
+	configMapName, namespace := "aws-auth", "kube-system"
+	var configMap *corev1.ConfigMap
+	var awsAuth *AWSAuth
+	var invalid error
+	o := ObjectStatus{Kind: "ConfigMap", Namespace: namespace, Name: configMapName}
+
+	// Attempt to validate that the aws-auth ConfigMap exists, and that its
+	// entries are valid. Invalid entries are retried, as they may still be
+	// updated, e.g. as node groups are added.
+	err := waitUntil(ctx, logger, b, fmt.Sprintf("ConfigMap %q", configMapName), "valid",
+		func() (bool, error) {
+			var err error
+			configMap, err = clientset.CoreV1().ConfigMaps(namespace).Get(configMapName, metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			awsAuth, invalid = validateAWSAuth(configMap, nodeRoleARNs)
+			return invalid == nil, invalid
+		})
+	if err != nil && configMap == nil {
+		o.Reason = "not found"
+		return ReadinessStatus{Objects: []ObjectStatus{o}},
+			fmt.Errorf("EKS ConfigMap %q does not exist in namespace %q: %w", configMapName, namespace, err)
+	}
+	if err != nil {
+		if invalid != nil {
+			o.Reason = invalid.Error()
 		}
-		awsAuthReady = true
-		break
+		return ReadinessStatus{Objects: []ObjectStatus{o}}, err
 	}
 
-	require.Equal(t, true, awsAuthReady, "EKS ConfigMap %q does not exist in namespace %q", configMapName, namespace)
-	require.NotNil(t, awsAuth.Data, "%s ConfigMap should not be nil", configMapName)
-	require.NotEmpty(t, awsAuth.Data, "%q ConfigMap should not be empty", configMapName)
-	PrintAndLog(fmt.Sprintf("EKS ConfigMap %q exists and has data\n", configMapName), t)
+	o.Ready = true
+	logger.Logf("EKS ConfigMap %q is valid, and maps %d roles and %d users\n",
+		configMapName, len(awsAuth.MapRoles), len(awsAuth.MapUsers))
+	return ReadinessStatus{Objects: []ObjectStatus{o}}, nil
 }
 
 // AssertAllNodesReady ensures that all Nodes are running & have a "Ready"
 // status condition.
 func AssertAllNodesReady(t *testing.T, clientset *kubernetes.Clientset, desiredNodeCount int) {
-	var nodes *corev1.NodeList
-	var err error
+	assertCheck(t, NodesCheck(), &CheckEnv{
+		KubeAccess:       &KubeAccess{Clientset: clientset},
+		DesiredNodeCount: desiredNodeCount,
+	})
+}
+
+// AssertAllNodesHealthy ensures that no Node is under pressure, cordoned, or
+// tainted as unhealthy.
+func AssertAllNodesHealthy(t *testing.T, clientset *kubernetes.Clientset) {
+	assertCheck(t, NodeHealthCheck(), &CheckEnv{KubeAccess: &KubeAccess{Clientset: clientset}})
+}
 
-	PrintAndLog(fmt.Sprintf("Total Desired Worker Node Count: %d\n", desiredNodeCount), t)
+// AssertSubjectPermissions ensures that the permissions of subject, e.g. the
+// user and groups of a roleMapping, are as expected, reviewed through the
+// admin kubeconfig of the cluster. See VerifySubjectPermissions.
+func AssertSubjectPermissions(t *testing.T, kubeconfig interface{}, subject RBACSubject,
+	permissions ...Permission) {
+	check := PermissionsCheck("permissions", SubjectPermissions{Subject: subject, Permissions: permissions})
+	assertCheck(t, check, kubeconfigCheckEnv(t, kubeconfig))
+}
+
+// AssertSelfPermissions ensures that the permissions of the user of a
+// kubeconfig, e.g. one scoped to an IAM role, are as expected. See
+// VerifySelfPermissions.
+func AssertSelfPermissions(t *testing.T, kubeconfig interface{}, permissions ...Permission) {
+	assertCheck(t, SelfPermissionsCheck("self-permissions", permissions...), kubeconfigCheckEnv(t, kubeconfig))
+}
+
+// AssertKubeconfigLint ensures that LintKubeconfig finds no problems with a
+// kubeconfig, as accepted by RunEKSSmokeTest, or with how it matches the EKS
+// clusters of the stack resources.
+func AssertKubeconfigLint(t *testing.T, kubeconfig interface{}, resources []apitype.ResourceV3) {
+	kc, err := serializeKubeconfig(kubeconfig)
+	require.NoError(t, err, "Invalid kubeconfig")
+	for _, finding := range LintKubeconfig(kc, resources) {
+		t.Errorf("Kubeconfig lint: %s", finding)
+	}
+}
+
+// kubeconfigCheckEnv creates the environment of a check run through a
+// kubeconfig, as accepted by RunEKSSmokeTest.
+func kubeconfigCheckEnv(t *testing.T, kubeconfig interface{}) *CheckEnv {
+	kc, err := serializeKubeconfig(kubeconfig)
+	require.NoError(t, err, "Invalid kubeconfig")
+	kubeAccess, err := KubeconfigToKubeAccess(kc)
+	require.NoError(t, err, "Invalid kubeconfig")
+	return &CheckEnv{KubeAccess: kubeAccess}
+}
+
+// WaitForAllNodesReady waits for the desired worker Node count of instances
+// to be up, running & have a "Ready" status.
+func WaitForAllNodesReady(ctx context.Context, logger Logger,
+	clientset kubernetes.Interface, desiredNodeCount int) (ReadinessStatus, error) {
+	logger.Logf("Total Desired Worker Node Count: %d\n", desiredNodeCount)
 
 	// Skip this validation if no NodeGroups are attached
 	if desiredNodeCount == 0 {
-		return
+		return ReadinessStatus{}, nil
 	}
 
-	// Attempt to validate that the total desired worker Node count of
-	// instances are up & running.
-	for i := 0; i < MaxRetries; i++ {
-		nodes, err = clientset.CoreV1().Nodes().List(metav1.ListOptions{})
-		if err != nil {
-			waitFor(t, "list of all Nodes", fmt.Sprintf("returned: %s", err))
-			continue
-		}
-		if desiredNodeCount == len(nodes.Items) {
-			break
-		} else {
-			waitFor(t, fmt.Sprintf("desired worker Node count of (%d) instances", desiredNodeCount), "running")
-		}
+	tracker, err := NewReadinessTracker(clientset, "nodes")
+	if err != nil {
+		return ReadinessStatus{}, err
 	}
+	tracker.Logger = logger
 
-	// Require that the Nodes returned are not empty & match the
-	// desiredNodeCount.
-	require.NotEmpty(t, nodes, "The Nodes list returned should not be empty")
-	require.Equal(t, desiredNodeCount, len(nodes.Items),
-		"%d out of %d desired worker Nodes are instantiated and running", len(nodes.Items), desiredNodeCount)
-
-	// Attempt to validate each Node has a "Ready" status.
-	var readyCount int
-	for _, node := range nodes.Items {
-		nodeReady := false
-		// Attempt to check if a Node is ready, and output the resulting status.
-		for i := 0; i < MaxRetries; i++ {
-			if ready := IsNodeReady(t, clientset, &node); ready {
-				nodeReady = true
-				readyCount++
-				break
-			} else {
-				waitFor(t, fmt.Sprintf("Node %q", node.Name), "ready")
-			}
-		}
-		PrintAndLog(fmt.Sprintf("Node: %s | Ready Status: %t\n", node.Name, nodeReady), t)
-	}
+	status, err := tracker.WaitForReady(ctx, func(s ReadinessStatus) bool {
+		return s.Count("Node") == desiredNodeCount && s.AllReady()
+	})
+	logReadiness(logger, status)
 
-	// Require that the readyCount matches the desiredNodeCount / total Nodes.
-	require.Equal(t, readyCount, len(nodes.Items),
-		"%d out of %d Nodes are ready", readyCount, len(nodes.Items))
+	// Validate that the Nodes returned match the desiredNodeCount, and are
+	// all ready.
+	if nodeCount := status.Count("Node"); nodeCount != desiredNodeCount {
+		return status, fmt.Errorf("%d out of %d desired worker Nodes are instantiated and running: %v",
+			nodeCount, desiredNodeCount, err)
+	}
+	if err != nil {
+		return status, fmt.Errorf("not all Nodes are ready: %w", err)
+	}
 
 	// Output the overall ready status.
-	PrintAndLog(fmt.Sprintf("%d out of %d Nodes are ready\n", readyCount, len(nodes.Items)), t)
+	logger.Logf("%d out of %d Nodes are ready\n", desiredNodeCount, desiredNodeCount)
+	return status, nil
 }
 
-// AssertKindInAllNamespacesReady ensures all Deployments have valid & ready status
-// conditions.
+// AssertKindInAllNamespacesReady ensures all objects of a kind have valid &
+// ready status conditions. Supported kinds are nodes, pods, deployments,
+// replicasets, daemonsets, statefulsets, jobs and cronjobs, or their kubectl
+// short names.
 func AssertKindInAllNamespacesReady(t *testing.T, clientset *kubernetes.Clientset, name string) {
-	var list interface{}
-	var err error
-
-	// Assume first non-error return of list is correct & complete,
-	// as we currently do not have a way of knowing ahead of time how many
-	// total to expect in each cluster before it is up and running.
-	for i := 0; i < MaxRetries; i++ {
-		switch n := strings.ToLower(name); {
-		case n == "deployments" || n == "deployment" || n == "deploy":
-			list, err = clientset.AppsV1().Deployments("").List(metav1.ListOptions{})
-			if err != nil {
-				waitFor(t, "Deployments list", fmt.Sprintf("returned: %s", err))
-			} else {
-				break
-			}
-		case n == "replicasets" || n == "replicaset" || n == "rs":
-			list, err = clientset.AppsV1().ReplicaSets("").List(metav1.ListOptions{})
-			if err != nil {
-				waitFor(t, "ReplicaSets list", fmt.Sprintf("returned: %s", err))
-			} else {
-				break
-			}
-		case n == "pods" || n == "pod" || n == "po":
-			list, err = clientset.CoreV1().Pods("").List(metav1.ListOptions{})
-			if err != nil {
-				waitFor(t, "Pods list", fmt.Sprintf("returned: %s", err))
-			} else {
-				break
-			}
-		}
-	}
+	AssertKindsReady(t, clientset, name)
+}
+
+// AssertKindsReady ensures all objects of the given kinds, across all
+// namespaces, have valid & ready status conditions. The kinds are tracked
+// together, and the wait ends as soon as all of their objects are ready.
+func AssertKindsReady(t *testing.T, clientset *kubernetes.Clientset, kinds ...string) {
+	AssertKindsReadyWithFilter(t, clientset, ReadinessFilter{}, kinds...)
+}
+
+// AssertKindsReadyWithFilter ensures all objects of the given kinds that pass
+// filter have valid & ready status conditions.
+func AssertKindsReadyWithFilter(t *testing.T, clientset *kubernetes.Clientset, filter ReadinessFilter,
+	kinds ...string) {
+	name := strings.ToLower(strings.Join(kinds, ","))
+	check := &readinessCheck{
+		name: name,
+		wait: func(ctx context.Context, env *CheckEnv) (ReadinessStatus, error) {
+			return WaitForKindsReadyWithFilter(ctx, env.Logger, env.KubeAccess.Clientset, filter, kinds...)
+		},
+	}
+	assertCheck(t, check, &CheckEnv{KubeAccess: &KubeAccess{Clientset: clientset}})
+}
+
+// WaitForKindsReady waits for all objects of the given kinds to be ready.
+func WaitForKindsReady(ctx context.Context, logger Logger,
+	clientset kubernetes.Interface, kinds ...string) (ReadinessStatus, error) {
+	return WaitForKindsReadyWithFilter(ctx, logger, clientset, ReadinessFilter{}, kinds...)
+}
 
-	// Require that the list returned is not empty.
-	require.NotEmpty(t, list, "The kind list returned should not be empty")
-	AssertKindListIsReady(t, clientset, list)
+// WaitForKindsReadyWithFilter waits for all objects of the given kinds that
+// pass filter to be ready.
+func WaitForKindsReadyWithFilter(ctx context.Context, logger Logger,
+	clientset kubernetes.Interface, filter ReadinessFilter, kinds ...string) (ReadinessStatus, error) {
+	tracker, err := NewReadinessTracker(clientset, kinds...)
+	if err != nil {
+		return ReadinessStatus{}, err
+	}
+	tracker.Logger = logger
+	tracker.Filter = filter
+
+	// We do not have a way of knowing ahead of time how many objects to
+	// expect in each cluster, so wait until at least one is returned and all
+	// of the objects returned are ready.
+	status, err := tracker.WaitForReady(ctx, func(s ReadinessStatus) bool {
+		return len(s.Objects) > 0 && s.AllReady()
+	})
+	return checkReadiness(logger, status, err)
 }
 
 // AssertKindListIsReady verifies that each item in a given resource list is
 // marked as ready.
 func AssertKindListIsReady(t *testing.T, clientset *kubernetes.Clientset, list interface{}) {
-	var readyCount int
-	var listLength int
-
-	// Attempt to validate each list item has a "Ready" status.
-	switch list.(type) {
-	case *appsv1.DeploymentList:
-		items := list.(*appsv1.DeploymentList).Items
-		listLength = len(items)
-		for _, item := range items {
-			ready := false
-			// Attempt to check if ready, and output the resulting status.
-			for i := 0; i < MaxRetries; i++ {
-				if IsDeploymentReady(t, clientset, &item) {
-					ready = true
-					readyCount++
-					break
-				} else {
-					waitFor(t, fmt.Sprintf("Deployment %q", item.Name), "ready")
-				}
-			}
-			PrintAndLog(fmt.Sprintf("Deployment: %s | Ready Status: %t\n", item.Name, ready), t)
-		}
+	check := &readinessCheck{
+		name: fmt.Sprintf("%T", list),
+		wait: func(ctx context.Context, env *CheckEnv) (ReadinessStatus, error) {
+			return WaitForKindListReady(ctx, env.Logger, env.KubeAccess.Clientset, list)
+		},
+	}
+	assertCheck(t, check, &CheckEnv{KubeAccess: &KubeAccess{Clientset: clientset}})
+}
 
-		// Validate that the readyCount is not 0, and matches the total Deployments
-		// returned.
-		require.NotEqual(t, readyCount, 0, "No Deployments are ready")
-		require.Equal(t, readyCount, listLength,
-			"%d out of %d Deployments are ready", readyCount, listLength)
-
-		PrintAndLog(fmt.Sprintf("%d out of %d Deployments are ready\n", readyCount, listLength), t)
-	case *appsv1.ReplicaSetList:
-		items := list.(*appsv1.ReplicaSetList).Items
-		listLength = len(items)
-		for _, item := range items {
-			ready := false
-			// Attempt to check if ready, and output the resulting status.
-			for i := 0; i < MaxRetries; i++ {
-				if IsReplicaSetReady(t, clientset, &item) {
-					ready = true
-					readyCount++
-					break
-				} else {
-					waitFor(t, fmt.Sprintf("ReplicaSet %q", item.Name), "ready")
-				}
-			}
-			PrintAndLog(fmt.Sprintf("ReplicaSet: %s | Ready Status: %t\n", item.Name, ready), t)
+// WaitForKindListReady waits for each item in a given resource list to be
+// ready.
+func WaitForKindListReady(ctx context.Context, logger Logger,
+	clientset kubernetes.Interface, list interface{}) (ReadinessStatus, error) {
+	// The kind is that of the typed list, e.g. DeploymentList.
+	runtimeList, ok := list.(runtime.Object)
+	if !ok || !meta.IsListType(runtimeList) {
+		return ReadinessStatus{}, fmt.Errorf("unsupported list type %T", list)
+	}
+	kind := strings.TrimSuffix(reflect.Indirect(reflect.ValueOf(list)).Type().Name(), "List")
+	if _, err := resolveKind(kind); err != nil {
+		return ReadinessStatus{}, fmt.Errorf("unsupported list type %T", list)
+	}
+	objs, err := meta.ExtractList(runtimeList)
+	if err != nil {
+		return ReadinessStatus{}, err
+	}
+	items := make([]metav1.Object, 0, len(objs))
+	for _, obj := range objs {
+		item, err := meta.Accessor(obj)
+		if err != nil {
+			return ReadinessStatus{}, err
 		}
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return ReadinessStatus{}, fmt.Errorf("no %ss are ready", kind)
+	}
 
-		// Validate that the readyCount is not 0, and matches the total ReplicaSets
-		// returned.
-		require.NotEqual(t, readyCount, 0, "No ReplicaSets are ready")
-		require.Equal(t, readyCount, listLength,
-			"%d out of %d ReplicaSets are ready", readyCount, listLength)
-
-		PrintAndLog(fmt.Sprintf("%d out of %d ReplicaSets are ready\n", readyCount, listLength), t)
-	case *corev1.PodList:
-		items := list.(*corev1.PodList).Items
-		listLength = len(items)
-		for _, item := range items {
-			ready := false
-			// Attempt to check if ready, and output the resulting status.
-			for i := 0; i < MaxRetries; i++ {
-				if IsPodReady(t, clientset, &item) {
-					ready = true
-					readyCount++
-					break
-				} else {
-					waitFor(t, fmt.Sprintf("Pod %q", item.Name), "ready")
-				}
-			}
-			PrintAndLog(fmt.Sprintf("Pod: %s | Ready Status: %t\n", item.Name, ready), t)
-		}
+	// Track only the items of the list, rather than all objects of the kind.
+	tracker, err := NewReadinessTracker(clientset, kind)
+	if err != nil {
+		return ReadinessStatus{}, err
+	}
+	tracker.Logger = logger
+	for _, item := range items {
+		tracker.Expect(kind, item.GetNamespace(), item.GetName())
+	}
+
+	status, err := tracker.WaitForReady(ctx, nil)
+	return checkReadiness(logger, status, err)
+}
 
-		// Validate that the readyCount is not 0, and matches the total Deployments
-		// returned.
-		require.NotEqual(t, readyCount, 0, "No Pods are ready")
-		require.Equal(t, readyCount, listLength,
-			"%d out of %d Pods are ready", readyCount, listLength)
+// checkReadiness logs the readiness of each object, and validates that there
+// are objects and that all of them are ready.
+func checkReadiness(logger Logger, status ReadinessStatus, err error) (ReadinessStatus, error) {
+	logReadiness(logger, status)
 
-		PrintAndLog(fmt.Sprintf("%d out of %d Pods are ready\n", readyCount, listLength), t)
+	if err != nil {
+		return status, err
+	}
+	if len(status.Objects) == 0 {
+		return status, fmt.Errorf("the kind list returned should not be empty")
 	}
+
+	logger.Logf("%d out of %d objects are ready\n", len(status.Objects), len(status.Objects))
+	return status, nil
 }
 
-// waitFor is a helper func that prints to stdout & sleeps to indicate a
-// wait & retry on a given resource, with an expected status.
-func waitFor(t *testing.T, resource, status string) {
-	t.Logf("Waiting for %s to be %s. Retrying...\n", resource, status)
-	time.Sleep(RetryInterval * time.Second)
+// logReadiness outputs the ready status of each object.
+func logReadiness(logger Logger, status ReadinessStatus) {
+	for _, o := range status.Objects {
+		if o.Ready && o.Reason == "" {
+			logger.Logf("%s: %s | Ready Status: %t\n", o.Kind, o.Name, o.Ready)
+		} else {
+			logger.Logf("%s: %s | Ready Status: %t | Reason: %s\n", o.Kind, o.Name, o.Ready, o.Reason)
+		}
+	}
 }
 
-// PrintAndLog is a helper fucn that prints a string to stdout,
-// and logs it to the testing logs.
-func PrintAndLog(s string, t *testing.T) {
-	t.Logf("%s", s)
+// PrintAndLog is a helper fucn that logs a string to the testing logs, or
+// any other Logger.
+func PrintAndLog(s string, logger Logger) {
+	logger.Logf("%s", s)
 }
 
 // IsNodeReady attempts to check if the Node status condition is ready.
@@ -312,14 +407,25 @@ func IsNodeReady(t *testing.T, clientset *kubernetes.Clientset, node *corev1.Nod
 	}
 
 	// Check the returned Node's conditions for readiness.
-	for _, condition := range o.Status.Conditions {
-		if condition.Type == corev1.NodeReady {
-			t.Logf("Checking if Node %q is Ready | Condition.Status: %q | Condition: %v\n", node.Name, condition.Status, condition)
-			return condition.Status == corev1.ConditionTrue
-		}
+	ready, reason := NodeReadiness(o)
+	t.Logf("Checking if Node %q is Ready | Ready: %t | Reason: %q\n", node.Name, ready, reason)
+	return ready
+}
+
+// IsNodeHealthy attempts to check if the Node is free of NodeHealth findings,
+// logging each finding.
+func IsNodeHealthy(t *testing.T, clientset *kubernetes.Clientset, node *corev1.Node) bool {
+	// Attempt to retrieve Node.
+	o, err := clientset.CoreV1().Nodes().Get(node.Name, metav1.GetOptions{})
+	if err != nil {
+		return false
 	}
 
-	return false
+	findings := NodeHealth(o)
+	for _, f := range findings {
+		t.Logf("%s\n", f)
+	}
+	return len(findings) == 0
 }
 
 // IsPodReady attempts to check if the Pod's status & condition is ready.
@@ -330,20 +436,16 @@ func IsPodReady(t *testing.T, clientset *kubernetes.Clientset, pod *corev1.Pod)
 		return false
 	}
 
-	// Check the returned Pod's status & conditions for readiness.
-	if o.Status.Phase == corev1.PodRunning || o.Status.Phase == corev1.PodSucceeded {
-		for _, condition := range o.Status.Conditions {
-			if condition.Type == corev1.PodReady {
-				t.Logf("Checking if Pod %q is Ready | Condition.Status: %q | Condition.Reason: %q | Condition: %v\n", pod.Name, condition.Status, condition.Reason, condition)
-				if o.Status.Phase == corev1.PodSucceeded {
-					return true
-				}
-				return condition.Status == corev1.ConditionTrue
-			}
+	// Check the returned Pod's status & conditions for readiness, and
+	// diagnose why it is not ready from its events.
+	ready, reason := PodReadiness(o)
+	if !ready {
+		if events, err := PodEvents(clientset, o); err == nil {
+			reason = DiagnosePod(o, events).String()
 		}
 	}
-
-	return false
+	t.Logf("Checking if Pod %q is Ready | Ready: %t | Reason: %q\n", pod.Name, ready, reason)
+	return ready
 }
 
 // IsDeploymentReady attempts to check if the Deployments's status conditions
@@ -356,14 +458,9 @@ func IsDeploymentReady(t *testing.T, clientset *kubernetes.Clientset, deployment
 	}
 
 	// Check the returned Deployment's status & conditions for readiness.
-	for _, condition := range o.Status.Conditions {
-		if condition.Type == appsv1.DeploymentAvailable {
-			t.Logf("Checking if Deployment %q is Available | Condition.Status: %q | Condition: %v\n", deployment.Name, condition.Status, condition)
-			return condition.Status == corev1.ConditionTrue
-		}
-	}
-
-	return false
+	ready, reason := DeploymentReadiness(o)
+	t.Logf("Checking if Deployment %q is Available | Ready: %t | Reason: %q\n", deployment.Name, ready, reason)
+	return ready
 }
 
 // IsReplicaSetReady attempts to check if the ReplicaSets's status conditions
@@ -376,16 +473,64 @@ func IsReplicaSetReady(t *testing.T, clientset *kubernetes.Clientset, replicaSet
 	}
 
 	// Check the returned ReplicaSet's status conditions for readiness.
-	for _, condition := range o.Status.Conditions {
-		if condition.Type == appsv1.ReplicaSetReplicaFailure {
-			return false
-		}
+	ready, _ := ReplicaSetReadiness(o)
+	return ready
+}
+
+// IsDaemonSetReady attempts to check if the DaemonSet's Pods are ready on all
+// of the Nodes that are eligible to run them.
+func IsDaemonSetReady(t *testing.T, clientset *kubernetes.Clientset, daemonSet *appsv1.DaemonSet) bool {
+	// Attempt to retrieve DaemonSet, and the Nodes it may run on.
+	o, err := clientset.AppsV1().DaemonSets(daemonSet.Namespace).Get(daemonSet.Name, metav1.GetOptions{})
+	if err != nil {
+		return false
+	}
+	nodeList, err := clientset.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return false
+	}
+	nodes := make([]*corev1.Node, len(nodeList.Items))
+	for i := range nodeList.Items {
+		nodes[i] = &nodeList.Items[i]
 	}
-	if o.Status.Replicas == o.Status.AvailableReplicas &&
-		o.Status.Replicas == o.Status.ReadyReplicas {
-		return true
+
+	// Check the returned DaemonSet's status, and its desired Pod count
+	// against the eligible Nodes.
+	ready, reason := DaemonSetReadiness(o)
+	if ready {
+		ready, reason = DaemonSetNodeReadiness(o, nodes)
 	}
-	return false
+	t.Logf("Checking if DaemonSet %q is Ready | Ready: %t | Reason: %q\n", daemonSet.Name, ready, reason)
+	return ready
+}
+
+// IsStatefulSetReady attempts to check if the StatefulSet's replicas are ready
+// and up to date.
+func IsStatefulSetReady(t *testing.T, clientset *kubernetes.Clientset, statefulSet *appsv1.StatefulSet) bool {
+	// Attempt to retrieve StatefulSet.
+	o, err := clientset.AppsV1().StatefulSets(statefulSet.Namespace).Get(statefulSet.Name, metav1.GetOptions{})
+	if err != nil {
+		return false
+	}
+
+	// Check the returned StatefulSet's status for readiness.
+	ready, reason := StatefulSetReadiness(o)
+	t.Logf("Checking if StatefulSet %q is Ready | Ready: %t | Reason: %q\n", statefulSet.Name, ready, reason)
+	return ready
+}
+
+// IsJobComplete attempts to check if the Job has completed.
+func IsJobComplete(t *testing.T, clientset *kubernetes.Clientset, job *batchv1.Job) bool {
+	// Attempt to retrieve Job.
+	o, err := clientset.BatchV1().Jobs(job.Namespace).Get(job.Name, metav1.GetOptions{})
+	if err != nil {
+		return false
+	}
+
+	// Check the returned Job's conditions for completion.
+	ready, reason := JobReadiness(o)
+	t.Logf("Checking if Job %q is Complete | Ready: %t | Reason: %q\n", job.Name, ready, reason)
+	return ready
 }
 
 // IsKubeconfigValid checks that the kubeconfig provided is valid and error-free.
@@ -447,25 +592,50 @@ func KubeconfigToKubeAccess(kubeconfig []byte) (*KubeAccess, error) {
 type clusterKubeAccessMap map[string]*KubeAccess
 
 // mapClusterToKubeAccess creates a map of the EKS cluster name to its
-// KubeAccess client tool bag, based on the kubeconfigs.
-func mapClusterToKubeAccess(kubeconfigs ...interface{}) (clusterKubeAccessMap, error) {
+// KubeAccess client tool bag, based on the kubeconfigs. Cluster names are
+// resolved with ClusterName, unless given with NamedKubeconfigs.
+func mapClusterToKubeAccess(resources []apitype.ResourceV3,
+	kubeconfigs ...interface{}) (clusterKubeAccessMap, error) {
 	// Map EKS cluster names to its KubeAccess.
 	clusterToKubeAccess := make(clusterKubeAccessMap)
-	for _, kubeconfig := range kubeconfigs {
+	add := func(clusterName string, kubeconfig []byte) error {
 		// Convert kubconfig to KubeAccess
-		kc, err := json.Marshal(kubeconfig)
+		kubeAccess, err := KubeconfigToKubeAccess(kubeconfig)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		kubeAccess, err := KubeconfigToKubeAccess(kc)
-		if err != nil {
-			return nil, err
+		if _, ok := clusterToKubeAccess[clusterName]; ok {
+			return fmt.Errorf("multiple kubeconfigs are for cluster %q", clusterName)
 		}
-
-		// Parse the kubeconfig user auth exec args for the cluster name.
-		clusterNameIndex := len(kubeAccess.RESTConfig.ExecProvider.Args) - 1
-		clusterName := kubeAccess.RESTConfig.ExecProvider.Args[clusterNameIndex]
 		clusterToKubeAccess[clusterName] = kubeAccess
+		return nil
+	}
+
+	for i, kubeconfig := range kubeconfigs {
+		if named, ok := kubeconfig.(NamedKubeconfigs); ok {
+			for clusterName, kubeconfig := range named {
+				kc, err := serializeKubeconfig(kubeconfig)
+				if err != nil {
+					return nil, fmt.Errorf("kubeconfig of cluster %q: %w", clusterName, err)
+				}
+				if err := add(clusterName, kc); err != nil {
+					return nil, fmt.Errorf("kubeconfig of cluster %q: %w", clusterName, err)
+				}
+			}
+			continue
+		}
+
+		kc, err := serializeKubeconfig(kubeconfig)
+		if err != nil {
+			return nil, fmt.Errorf("kubeconfig %d: %w", i, err)
+		}
+		clusterName, err := ClusterName(kc, resources)
+		if err != nil {
+			return nil, fmt.Errorf("kubeconfig %d: %w", i, err)
+		}
+		if err := add(clusterName, kc); err != nil {
+			return nil, fmt.Errorf("kubeconfig %d: %w", i, err)
+		}
 	}
 
 	return clusterToKubeAccess, nil
@@ -475,8 +645,9 @@ type cloudFormationTemplateBody struct {
 	Resources struct {
 		NodeGroup struct {
 			Properties struct {
-				DesiredCapacity int                 `yaml:"DesiredCapacity"`
-				Tags            []map[string]string `yaml:"Tags"`
+				DesiredCapacity         int                 `yaml:"DesiredCapacity"`
+				LaunchConfigurationName string              `yaml:"LaunchConfigurationName"`
+				Tags                    []map[string]string `yaml:"Tags"`
 			} `yaml:"Properties"`
 		} `yaml:"NodeGroup"`
 	} `yaml:"Resources"`
@@ -486,81 +657,76 @@ type cloudFormationTemplateBody struct {
 // respective total desired worker Node count for *all* NodeGroups.
 type clusterNodeCountMap map[string]int
 
-// mapClusterToNodeCount iterates through all Pulumi stack resources
-// looking for CloudFormation template bodies to extract, and aggregate
-// the total desired worker Node count per cluster in the Pulumi stack resources.
-//
-// Note: There can be many CF template bodies if multiple NodeGroups are used,
-// but all NodeGroups belonging to the same cluster get their desired Node count
-// aggregated into a total per cluster.
+// mapClusterToNodeCount aggregates the desired worker Node count of all of the
+// NodeGroups of each cluster in the Pulumi stack resources into a total per
+// cluster. See mapClusterToNodeGroups for the count of each NodeGroup.
 func mapClusterToNodeCount(resources []apitype.ResourceV3) (clusterNodeCountMap, error) {
-	clusterToNodeCount := make(clusterNodeCountMap)
-
-	// Map cluster to its NodeGroups.
-	cfnPrefix := "arn:aws:cloudformation"     // self-managed CF-based node gruops
-	ngPrefix := "aws:eks/nodeGroup:NodeGroup" // AWS managed node groups
-
-	for _, res := range resources {
-		if strings.HasPrefix(res.ID.String(), cfnPrefix) {
-			var templateBody cloudFormationTemplateBody
-			body := res.Outputs["templateBody"].(string)
-			err := yaml.Unmarshal([]byte(body), &templateBody)
-			if err != nil {
-				return nil, err
-			}
+	clusterToNodeGroups, err := mapClusterToNodeGroups(resources)
+	if err != nil {
+		return nil, err
+	}
+	return totalNodeCounts(clusterToNodeGroups), nil
+}
 
-			// Find the CF "Name" tag to extract the cluster name.
-			tags := templateBody.Resources.NodeGroup.Properties.Tags
-			nameTag := ""
-			for _, tag := range tags {
-				if tag["Key"] == "Name" {
-					nameTag = tag["Value"]
-				}
-			}
-			clusterName := strings.Split(nameTag, "-worker")[0]
-
-			// Update map of cluster name to total desired Node count.
-			clusterToNodeCount[clusterName] =
-				clusterToNodeCount[clusterName] +
-					templateBody.Resources.NodeGroup.Properties.DesiredCapacity
-		} else if res.Type.String() == ngPrefix {
-			// Extract the cluster name.
-			nodegroup := res.Inputs
-			clusterName := nodegroup["clusterName"].(string)
-
-			// Extract the desired size.
-			scalingConfig := nodegroup["scalingConfig"].(map[string]interface{})
-			desiredSize := int(scalingConfig["desiredSize"].(float64))
-
-			// Update map of cluster name to total desired Node count.
-			clusterToNodeCount[clusterName] =
-				clusterToNodeCount[clusterName] + desiredSize
+// totalNodeCounts returns the total desired Node count of the node groups of
+// each cluster.
+func totalNodeCounts(clusterToNodeGroups clusterNodeGroupsMap) clusterNodeCountMap {
+	clusterToNodeCount := make(clusterNodeCountMap)
+	for clusterName, groups := range clusterToNodeGroups {
+		for _, g := range groups {
+			clusterToNodeCount[clusterName] += g.DesiredCount
 		}
 	}
+	return clusterToNodeCount
+}
 
-	return clusterToNodeCount, nil
+// nodeGroupClusterName extracts the cluster name from the CF "Name" tag of a
+// NodeGroup, i.e. "<cluster>-worker".
+func nodeGroupClusterName(tags []map[string]string) string {
+	nameTag := ""
+	for _, tag := range tags {
+		if tag["Key"] == "Name" {
+			nameTag = tag["Value"]
+		}
+	}
+	return strings.Split(nameTag, "-worker")[0]
 }
 
 // AssertHTTPResultWithRetry attempts to assert that an HTTP endpoint exists
 // and evaluate its response.
 func AssertHTTPResultWithRetry(t *testing.T, output interface{}, headers map[string]string, maxWait time.Duration, check func(string) bool) bool {
-	hostname, ok := output.(string)
-	if !assert.True(t, ok, fmt.Sprintf("expected `%s` output", output)) {
+	body, err := GetHTTPBodyWithRetry(context.Background(), t, output, headers, maxWait)
+	if !assert.NoError(t, err) {
 		return false
 	}
+	// Verify it matches expectations
+	return check(body)
+}
+
+// GetHTTPBodyWithRetry attempts to http.get an endpoint successfully, until
+// maxWait has elapsed or ctx is done, and returns the body of its response.
+// If the endpoint still responds with an unsuccessful status by then, the body
+// of that response is returned for the caller to check, and only a failure to
+// get any response is returned as an error.
+func GetHTTPBodyWithRetry(ctx context.Context, logger Logger, output interface{},
+	headers map[string]string, maxWait time.Duration) (string, error) {
+	hostname, ok := output.(string)
+	if !ok {
+		return "", fmt.Errorf("expected `%v` output to be a string", output)
+	}
 	if !(strings.HasPrefix(hostname, "http://") || strings.HasPrefix(hostname, "https://")) {
 		hostname = fmt.Sprintf("http://%s", hostname)
 	}
-	var err error
 	var resp *http.Response
 	startTime := time.Now()
 	count, sleep := 0, 0
 	for true {
 		now := time.Now()
 		req, err := http.NewRequest("GET", hostname, nil)
-		if !assert.NoError(t, err, "error reading request: %v", err) {
-			return false
+		if err != nil {
+			return "", fmt.Errorf("error reading request: %w", err)
 		}
+		req = req.WithContext(ctx)
 
 		for k, v := range headers {
 			// Host header cannot be set via req.Header.Set(), and must be set
@@ -578,10 +744,18 @@ func AssertHTTPResultWithRetry(t *testing.T, output interface{}, headers map[str
 		if err == nil && resp.StatusCode == 200 {
 			break
 		}
-		if now.Sub(startTime) >= maxWait {
-			t.Logf("Timeout after %v. Unable to http.get %v successfully.", maxWait, hostname)
+		if now.Sub(startTime) >= maxWait || ctx.Err() != nil {
+			logger.Logf("Timeout after %v. Unable to http.get %v successfully.", now.Sub(startTime), hostname)
+			if err != nil {
+				return "", err
+			}
+			// Leave the body of the last response for the caller to check.
 			break
 		}
+		if err == nil {
+			resp.Body.Close()
+			err = fmt.Errorf("http.get %v returned status %s", hostname, resp.Status)
+		}
 		count++
 		// delay 10s, 20s, then 30s and stay at 30s
 		if sleep > 30 {
@@ -589,19 +763,15 @@ func AssertHTTPResultWithRetry(t *testing.T, output interface{}, headers map[str
 		} else {
 			sleep += 10
 		}
-		time.Sleep(time.Duration(sleep) * time.Second)
-		t.Logf("Http Error: %v\n", err)
-		t.Logf("  Retry: %v, elapsed wait: %v, max wait %v\n", count, now.Sub(startTime), maxWait)
-	}
-	if !assert.NoError(t, err) {
-		return false
+		sleepWithContext(ctx, time.Duration(sleep)*time.Second)
+		logger.Logf("Http Error: %v\n", err)
+		logger.Logf("  Retry: %v, elapsed wait: %v, max wait %v\n", count, now.Sub(startTime), maxWait)
 	}
 	// Read the body
 	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
-	if !assert.NoError(t, err) {
-		return false
+	if err != nil {
+		return "", err
 	}
-	// Verify it matches expectations
-	return check(string(body))
+	return string(body), nil
 }
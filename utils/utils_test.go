@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetHTTPBodyWithRetry(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "example.com", r.Host)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, "upstream unavailable")
+	}))
+	url := server.URL
+
+	// The body of an unsuccessful response is left for the caller to check.
+	body, err := GetHTTPBodyWithRetry(context.Background(), DiscardLogger, url,
+		map[string]string{"Host": "example.com"}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "upstream unavailable", body)
+
+	server.Close()
+	_, err = GetHTTPBodyWithRetry(context.Background(), DiscardLogger, url, nil, 0)
+	assert.Error(t, err)
+}
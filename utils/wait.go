@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// backoff computes exponentially increasing intervals in between requests to
+// the Kubernetes API Server.
+type backoff struct {
+	interval time.Duration
+	max      time.Duration
+	factor   float64
+}
+
+// next returns the interval to wait before the next attempt, and grows the
+// interval for the attempt after it.
+func (b *backoff) next() time.Duration {
+	current := b.interval
+	b.interval = time.Duration(float64(b.interval) * b.factor)
+	if b.interval > b.max {
+		b.interval = b.max
+	}
+	return current
+}
+
+// waitUntil calls cond until it returns true, or until ctx is done.
+//
+// Errors returned by cond are treated as transient: they are logged, and the
+// condition is retried. The last error seen is included in the returned error
+// if ctx is done before cond succeeds.
+func waitUntil(ctx context.Context, logger Logger, b *backoff, resource, status string,
+	cond func() (bool, error)) error {
+	var lastErr error
+	for {
+		done, err := cond()
+		if done {
+			return nil
+		}
+		if err != nil {
+			lastErr = err
+		}
+
+		wait := b.next()
+		if err != nil {
+			logger.Logf("Waiting for %s to be %s (%v). Retrying in %v...\n", resource, status, err, wait)
+		} else {
+			logger.Logf("Waiting for %s to be %s. Retrying in %v...\n", resource, status, wait)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			if lastErr != nil {
+				return fmt.Errorf("%s is not %s: %v: %w", resource, status, lastErr, ctx.Err())
+			}
+			return fmt.Errorf("%s is not %s: %w", resource, status, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// sleepWithContext waits for d, or until ctx is done.
+func sleepWithContext(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}